@@ -0,0 +1,61 @@
+package logrus_fluent
+
+import (
+	"reflect"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AppendField returns a new entry with the value appended to the field,
+// instead of overwriting it like entry.WithField.
+// The field in Config.AccumulateField is expected to be set by this function,
+//
+//	entry = logrus_fluent.AppendField(entry, "step", "auth")
+//	entry = logrus_fluent.AppendField(entry, "step", "query") // => ["auth", "query"]
+//
+// When the field already has a non-slice value, it becomes the first element.
+// A slice value is copied, so the parent entry is never modified.
+func AppendField(entry *logrus.Entry, key string, value interface{}) *logrus.Entry {
+	old, ok := entry.Data[key]
+	if !ok || old == nil {
+		return entry.WithField(key, []interface{}{value})
+	}
+
+	list := toInterfaceSlice(old)
+	result := make([]interface{}, 0, len(list)+1)
+	result = append(result, list...)
+	result = append(result, value)
+	return entry.WithField(key, result)
+}
+
+// accumulateValue wraps the non-slice value into a slice,
+// so the field in Config.AccumulateField always has the same type in the record.
+func accumulateValue(v interface{}) interface{} {
+	if v == nil {
+		return []interface{}{}
+	}
+	return toInterfaceSlice(v)
+}
+
+// toInterfaceSlice converts the value to []interface{}.
+// The non-slice value is wrapped into a slice with one element.
+func toInterfaceSlice(v interface{}) []interface{} {
+	if list, ok := v.([]interface{}); ok {
+		return list
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return []interface{}{v} // []byte is a single value.
+		}
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = rv.Index(i).Interface()
+		}
+		return list
+	default:
+		return []interface{}{v}
+	}
+}
@@ -0,0 +1,37 @@
+package logrus_fluent
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendField(t *testing.T) {
+	a := assert.New(t)
+
+	parent := logrus.NewEntry(logrus.New())
+	entry := AppendField(parent, "step", "auth")
+	a.Equal([]interface{}{"auth"}, entry.Data["step"])
+
+	child := AppendField(entry, "step", "query")
+	a.Equal([]interface{}{"auth", "query"}, child.Data["step"])
+	a.Equal([]interface{}{"auth"}, entry.Data["step"], "parent entry should not be modified")
+
+	entry = parent.WithField("step", "init")
+	entry = AppendField(entry, "step", "auth")
+	a.Equal([]interface{}{"init", "auth"}, entry.Data["step"])
+
+	entry = parent.WithField("step", []string{"init"})
+	entry = AppendField(entry, "step", "auth")
+	a.Equal([]interface{}{"init", "auth"}, entry.Data["step"])
+}
+
+func TestAccumulateValue(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal([]interface{}{}, accumulateValue(nil))
+	a.Equal([]interface{}{"a"}, accumulateValue("a"))
+	a.Equal([]interface{}{1, 2}, accumulateValue([]int{1, 2}))
+	a.Equal([]interface{}{[]byte("ab")}, accumulateValue([]byte("ab")))
+}
@@ -0,0 +1,325 @@
+package logrus_fluent
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// criticalFlushTimeout is the max time to wait for the async buffer
+// before sending the entry of Panic, Fatal or Config.SyncLevels.
+const criticalFlushTimeout = 5 * time.Second
+
+// ErrClosed is returned when the hook is used after Close.
+var ErrClosed = errors.New("logrus_fluent: hook is closed")
+
+// OverflowPolicy is the way to handle the entry when the async buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until the buffer has space.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDrop drops the new entry and counts it in Stats.Dropped.
+	OverflowDrop
+	// OverflowDropOldest drops the oldest entry in the buffer to add the new entry,
+	// and counts it in Stats.Dropped.
+	OverflowDropOldest
+)
+
+// OverflowDropNewest is the alias of OverflowDrop.
+const OverflowDropNewest = OverflowDrop
+
+// defaultAsyncBufferSize is the buffer size of Config.Async without the size.
+const defaultAsyncBufferSize = 8192
+
+// asyncBufferSize returns the size of the async buffer, or 0 when the async mode is disabled.
+func asyncBufferSize(conf Config) int {
+	switch {
+	case conf.AsyncBufferSize > 0:
+		return conf.AsyncBufferSize
+	case !conf.Async:
+		return 0
+	case conf.BufferLimit > 0:
+		return conf.BufferLimit
+	default:
+		return defaultAsyncBufferSize
+	}
+}
+
+// event is the converted log entry to send.
+type event struct {
+	tag     string
+	data    logrus.Fields // the record before the conversion, passed to Config.OnError
+	record  interface{}
+	options map[string]string // sent in the forward message, see Config.MessageOptions
+	level   logrus.Level
+	time    time.Time
+
+	flushed chan struct{} // closed by the worker instead of sending, see Flush
+	batch   []*event      // the events sent together, see Config.BatchMode
+	entry   *logrus.Entry // the copy of the entry for the error handler, see SetErrorHandler
+	file    string        // the chunk file removed after the send, see Config.BufferPath
+	mirror  bool          // the record is mirrored by deliver, see Config.MirrorOutputs
+}
+
+// events returns the events in the batch, or the event itself.
+func (ev *event) events() []*event {
+	if ev.batch != nil {
+		return ev.batch
+	}
+	return []*event{ev}
+}
+
+// startWorker starts the background worker to send the buffered events.
+// The replayed events are sent before the new ones.
+func (hook *FluentHook) startWorker(size int, replay []*event) {
+	queue := make(chan *event, size)
+	hook.queue = queue
+	hook.done = make(chan struct{})
+	go func() {
+		for _, ev := range replay {
+			hook.deliver(ev)
+		}
+		if hook.conf.BatchMode != BatchNone {
+			hook.batchWorker(queue)
+			return
+		}
+		hook.worker(queue)
+	}()
+}
+
+func (hook *FluentHook) worker(queue <-chan *event) {
+	defer close(hook.done)
+	for ev := range queue {
+		if ev.flushed != nil {
+			close(ev.flushed)
+			continue
+		}
+		hook.deliver(ev)
+	}
+}
+
+// isClosed reports whether Close has been called.
+func (hook *FluentHook) isClosed() bool {
+	hook.closeMu.RLock()
+	defer hook.closeMu.RUnlock()
+	return hook.closed
+}
+
+// enqueue adds the event into the async buffer.
+// OverflowBlock waits for the space until the context is done.
+func (hook *FluentHook) enqueue(ctx context.Context, ev *event) error {
+	hook.closeMu.RLock()
+	defer hook.closeMu.RUnlock()
+	if hook.closed {
+		return ErrClosed
+	}
+	if hook.buffer != nil {
+		if err := hook.buffer.write(ev); err != nil {
+			return err
+		}
+	}
+
+	switch hook.conf.OverflowPolicy {
+	case OverflowDrop:
+		select {
+		case hook.queue <- ev:
+		default:
+			hook.buffer.remove(ev)
+			hook.stats.dropped.Add(1)
+			hook.deadLetter(ev, ErrBufferFull)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case hook.queue <- ev:
+				return nil
+			default:
+			}
+			select {
+			case old := <-hook.queue:
+				hook.dropOldest(old)
+			default:
+			}
+		}
+	default:
+		select {
+		case hook.queue <- ev:
+		case <-ctx.Done():
+			hook.buffer.remove(ev)
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// dropOldest drops the event taken from the head of the async buffer.
+// The flush marker is released instead, as the events before it have already left the buffer.
+func (hook *FluentHook) dropOldest(ev *event) {
+	if ev.flushed != nil {
+		close(ev.flushed)
+		return
+	}
+	hook.buffer.remove(ev)
+	hook.stats.dropped.Add(1)
+	hook.deadLetter(ev, ErrBufferFull)
+}
+
+// Flush blocks until the entries buffered before the call are sent
+// and the buffered connection is written, or the context is done.
+func (hook *FluentHook) Flush(ctx context.Context) error {
+	if hook.queue != nil {
+		if err := hook.waitQueue(ctx); err != nil {
+			return err
+		}
+	} else if hook.isClosed() {
+		return ErrClosed
+	}
+	return hook.flushClients()
+}
+
+// waitQueue blocks until the entries in the async buffer are sent.
+func (hook *FluentHook) waitQueue(ctx context.Context) error {
+	flushed := make(chan struct{})
+	if err := hook.enqueueFlush(ctx, flushed); err != nil {
+		return err
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flushClients writes the buffered data of the persistent loggers.
+func (hook *FluentHook) flushClients() error {
+	hook.endpointMu.RLock()
+	defer hook.endpointMu.RUnlock()
+	var err error
+	for _, p := range hook.pool {
+		if e := flushClient(p.client); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// deliverCritical sends the event of Panic, Fatal or Config.SyncLevels, which may be followed by the process exit.
+// The buffered entries are sent before it, and it's written into the connection
+// (and acknowledged with RequireAck) before returning.
+func (hook *FluentHook) deliverCritical(ev *event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), criticalFlushTimeout)
+	defer cancel()
+
+	if hook.queue != nil {
+		// the critical entry is sent anyway even if the buffer isn't drained in time.
+		hook.waitQueue(ctx)
+	}
+	err := hook.deliver(ev)
+	if e := hook.flushClients(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// enqueueFlush adds the flush marker into the async buffer.
+// The marker is never dropped, so it waits for the space regardless of OverflowPolicy.
+func (hook *FluentHook) enqueueFlush(ctx context.Context, flushed chan struct{}) error {
+	hook.closeMu.RLock()
+	defer hook.closeMu.RUnlock()
+	if hook.closed {
+		return ErrClosed
+	}
+
+	select {
+	case hook.queue <- &event{flushed: flushed}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close sends all of the buffered entries and disconnects the senders and the persistent loggers.
+// The sends continued after SendTimeout are waited for, and they're not retried after that.
+func (hook *FluentHook) Close() error {
+	hook.closeMu.Lock()
+	if hook.closed {
+		hook.closeMu.Unlock()
+		return nil
+	}
+	hook.closed = true
+	if hook.queue != nil {
+		close(hook.queue)
+	}
+	hook.closeMu.Unlock()
+
+	if hook.done != nil {
+		<-hook.done
+	}
+	hook.endpointMu.RLock()
+	healthCheck := hook.healthCheck
+	hook.endpointMu.RUnlock()
+	healthCheck.close()
+	if hook.sampleSummary != nil {
+		hook.sampleSummary.close()
+		hook.sendSampleSummary()
+	}
+	if hook.dedupFlush != nil {
+		hook.dedupFlush.close()
+		hook.sendRepeats(true)
+	}
+	err := hook.disconnectSender()
+	if e := disconnectMirrors(hook.conf.MirrorSenders); e != nil {
+		err = e
+	}
+	_, pool := hook.connections()
+	for _, p := range pool {
+		if e := p.close(); e != nil {
+			err = e
+		}
+	}
+
+	// the deliveries abandoned by the context fail on the closed connections, or finish.
+	hook.inflight.Wait()
+	return err
+}
+
+// periodic runs the function on the interval in the background until close is called.
+type periodic struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+func startPeriodic(interval time.Duration, fn func()) *periodic {
+	p := &periodic{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(p.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// close stops the loop and waits for the running function. It does nothing on nil.
+func (p *periodic) close() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.done
+}
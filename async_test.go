@@ -0,0 +1,250 @@
+package logrus_fluent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
+)
+
+func TestAsync(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:            testHOST,
+		Port:            port,
+		AsyncBufferSize: defaultLoopCount,
+	})
+	a.NoError(err)
+
+	for i := 0; i < defaultLoopCount; i++ {
+		a.NoError(hook.Fire(newEntry(logrus.Fields{"value": i}, entryMessage)))
+	}
+	a.NoError(hook.Close())
+	for i := 0; i < defaultLoopCount; i++ {
+		msg := receiveMessage(t, messages)
+		a.EqualValues(i, msg.Record["value"])
+	}
+
+	a.Equal(ErrClosed, hook.Fire(newEntry(nil, entryMessage)))
+	a.NoError(hook.Close())
+}
+
+func TestEnqueueOverflow(t *testing.T) {
+	a := assert.New(t)
+
+	ev := &event{tag: fieldTag}
+	hook := &FluentHook{
+		queue: make(chan *event, 1),
+		conf:  Config{OverflowPolicy: OverflowDrop},
+	}
+	a.NoError(hook.enqueue(context.Background(), ev))
+	a.NoError(hook.enqueue(context.Background(), ev))
+	a.EqualValues(1, hook.Stats().Dropped)
+	a.Len(hook.queue, 1)
+
+	hook.conf.OverflowPolicy = OverflowBlock
+	go func() { <-hook.queue }()
+	a.NoError(hook.enqueue(context.Background(), ev))
+	a.EqualValues(1, hook.Stats().Dropped)
+
+	// the oldest entry is replaced, and the flush marker is released.
+	hook.conf.OverflowPolicy = OverflowDropOldest
+	newer := &event{tag: staticTag}
+	a.NoError(hook.enqueue(context.Background(), newer))
+	a.EqualValues(2, hook.Stats().Dropped)
+	a.Equal(newer, <-hook.queue)
+
+	flushed := make(chan struct{})
+	hook.queue <- &event{flushed: flushed}
+	a.NoError(hook.enqueue(context.Background(), ev))
+	a.EqualValues(2, hook.Stats().Dropped)
+	a.Equal(ev, <-hook.queue)
+	<-flushed
+}
+
+func TestAsyncBufferSize(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(0, asyncBufferSize(Config{}))
+	a.Equal(0, asyncBufferSize(Config{BufferLimit: 10}))
+	a.Equal(10, asyncBufferSize(Config{AsyncBufferSize: 10, Async: true, BufferLimit: 20}))
+	a.Equal(20, asyncBufferSize(Config{Async: true, BufferLimit: 20}))
+	a.Equal(defaultAsyncBufferSize, asyncBufferSize(Config{Async: true}))
+}
+
+func TestAsyncSyncLevels(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:               testHOST,
+		Port:               port,
+		AsyncBufferSize:    defaultLoopCount,
+		SyncLevels:         []logrus.Level{logrus.WarnLevel},
+		WriteBufferSize:    4096,
+		WriteFlushInterval: time.Hour,
+	})
+	a.NoError(err)
+
+	// the entry of the sync level is sent after the buffered one, and the connection is flushed.
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	entry := newEntry(nil, entryMessage)
+	entry.Level = logrus.WarnLevel
+	a.NoError(hook.Fire(entry))
+	a.Equal("error", receiveMessage(t, messages).Record["level"])
+	a.Equal("warning", receiveMessage(t, messages).Record["level"])
+	a.EqualValues(0, hook.Stats().Dropped)
+
+	a.NoError(hook.Close())
+}
+
+func TestFlush(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:               testHOST,
+		Port:               port,
+		AsyncBufferSize:    defaultLoopCount,
+		WriteBufferSize:    4096,
+		WriteFlushInterval: time.Hour,
+	})
+	a.NoError(err)
+
+	for i := 0; i < defaultLoopCount; i++ {
+		a.NoError(hook.Fire(newEntry(logrus.Fields{"value": i}, entryMessage)))
+	}
+	a.NoError(hook.Flush(context.Background()))
+	for i := 0; i < defaultLoopCount; i++ {
+		msg := receiveMessage(t, messages)
+		a.EqualValues(i, msg.Record["value"])
+	}
+
+	a.NoError(hook.Close())
+	a.Equal(ErrClosed, hook.Flush(context.Background()))
+}
+
+func TestFireAfterClose(t *testing.T) {
+	a := assert.New(t)
+
+	port, _ := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host: testHOST,
+		Port: port,
+	})
+	a.NoError(err)
+
+	a.NoError(hook.Flush(context.Background()))
+	a.NoError(hook.Close())
+	a.Equal(ErrClosed, hook.Fire(newEntry(nil, entryMessage)))
+	a.Equal(ErrClosed, hook.Flush(context.Background()))
+}
+
+func TestOnError(t *testing.T) {
+	a := assert.New(t)
+
+	type failure struct {
+		err  error
+		tag  string
+		data logrus.Fields
+	}
+	failures := make(chan failure, 2)
+	conf := Config{
+		Host:                  testHOST,
+		Port:                  -1,
+		DisableConnectionPool: true,
+		OnError: func(err error, tag string, data logrus.Fields) {
+			failures <- failure{err, tag, data}
+		},
+	}
+
+	for _, size := range []int{0, 1} {
+		conf.AsyncBufferSize = size
+		hook, err := NewWithConfig(conf)
+		a.NoError(err)
+
+		err = hook.Fire(newEntry(logrus.Fields{"value": fieldValue}, entryMessage))
+		a.NoError(hook.Close())
+
+		f := <-failures
+		if size == 0 {
+			a.Equal(err, f.err)
+		}
+		a.Error(f.err)
+		a.Equal(entryMessage, f.tag)
+		a.Equal(fieldValue, f.data["value"])
+	}
+}
+
+func TestSetErrorHandler(t *testing.T) {
+	a := assert.New(t)
+
+	sendErr := errors.New("send error")
+	sender := testutil.NewMockSender()
+	sender.SetError(sendErr)
+
+	for _, size := range []int{0, 1} {
+		hook, err := NewWithConfig(Config{Sender: sender, AsyncBufferSize: size})
+		a.NoError(err)
+
+		entries := make(chan *logrus.Entry, 1)
+		hook.SetErrorHandler(func(entry *logrus.Entry, err error) {
+			a.ErrorIs(err, sendErr)
+			entries <- entry
+		})
+
+		entry := newEntry(logrus.Fields{"value": fieldValue}, entryMessage)
+		hook.Fire(entry)
+		a.NoError(hook.Close())
+
+		got := <-entries
+		a.NotSame(entry, got)
+		a.Equal(entryMessage, got.Message)
+		a.Equal(fieldValue, got.Data["value"])
+
+		hook.SetErrorHandler(nil)
+		a.Nil(hook.errorHandler.Load())
+	}
+}
+
+func TestFireCritical(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:               testHOST,
+		Port:               port,
+		AsyncBufferSize:    defaultLoopCount,
+		SyncLevels:         []logrus.Level{logrus.DebugLevel},
+		WriteBufferSize:    4096,
+		WriteFlushInterval: time.Hour,
+	})
+	a.NoError(err)
+	defer hook.Close()
+
+	for i := 0; i < 3; i++ {
+		a.NoError(hook.Fire(newEntry(logrus.Fields{"value": i}, entryMessage)))
+	}
+	entry := newEntry(nil, entryMessage)
+	entry.Level = logrus.FatalLevel
+	a.NoError(hook.Fire(entry))
+
+	// the buffered entries and the fatal entry are written before Fire returns.
+	for i := 0; i < 3; i++ {
+		select {
+		case msg := <-messages:
+			a.EqualValues(i, msg.Record["value"])
+		case <-time.After(time.Second):
+			t.Fatal("buffered entry is not sent")
+		}
+	}
+	a.Equal("fatal", receiveMessage(t, messages).Record["level"])
+	a.EqualValues(4, hook.Stats().Sent)
+}
@@ -0,0 +1,94 @@
+package logrus_fluent
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/IBM/fluent-forward-go/fluent/protocol"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// authInfo is the credentials of the secure forward handshake.
+type authInfo struct {
+	sharedKey []byte
+	hostname  string
+	username  string
+	password  string
+	timeout   time.Duration // deadline of the whole handshake (0 is no timeout)
+}
+
+// newAuthInfo returns the credentials in the config, or nil when SharedKey isn't set.
+func newAuthInfo(conf Config) *authInfo {
+	if conf.SharedKey == "" {
+		return nil
+	}
+	a := &authInfo{
+		sharedKey: []byte(conf.SharedKey),
+		hostname:  conf.SelfHostname,
+		username:  conf.Username,
+		password:  conf.Password,
+		timeout:   conf.Timeout,
+	}
+	if a.hostname == "" {
+		a.hostname, _ = os.Hostname()
+	}
+	return a
+}
+
+// handshake performs HELO/PING/PONG handshake on the new connection.
+// The password is sent as the digest with the salt in HELO when the server requires the user authentication.
+func (a *authInfo) handshake(conn net.Conn) error {
+	if a.timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(a.timeout)); err != nil {
+			return err
+		}
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	r := msgp.NewReader(conn)
+	var helo protocol.Helo
+	if err := helo.DecodeMsg(r); err != nil {
+		return fmt.Errorf("logrus_fluent: failed to read HELO: %w", err)
+	}
+	var nonce, authSalt []byte
+	if helo.Options != nil {
+		nonce, authSalt = helo.Options.Nonce, helo.Options.Auth
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	var password string
+	if a.username != "" || len(authSalt) > 0 {
+		h := sha512.New()
+		h.Write(authSalt)
+		h.Write([]byte(a.username))
+		h.Write([]byte(a.password))
+		password = hex.EncodeToString(h.Sum(nil))
+	}
+	ping, err := protocol.NewPingWithAuth(a.hostname, a.sharedKey, salt, nonce, a.username, password)
+	if err != nil {
+		return err
+	}
+	if err := msgp.Encode(conn, ping); err != nil {
+		return err
+	}
+
+	var pong protocol.Pong
+	if err := pong.DecodeMsg(r); err != nil {
+		return fmt.Errorf("logrus_fluent: failed to read PONG: %w", err)
+	}
+	if !pong.AuthResult {
+		return fmt.Errorf("logrus_fluent: authentication failed: %s", pong.Reason)
+	}
+	if err := protocol.ValidatePongDigest(&pong, a.sharedKey, nonce, salt); err != nil {
+		return fmt.Errorf("logrus_fluent: invalid PONG digest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package logrus_fluent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"time"
+
+	"github.com/IBM/fluent-forward-go/fluent/protocol"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// BatchMode is the forward message mode to send the batched entries.
+type BatchMode int
+
+const (
+	// BatchNone sends every entry as a Message.
+	BatchNone BatchMode = iota
+	// BatchForward sends the entries of the same tag as a Forward message.
+	BatchForward
+	// BatchPackedForward sends the entries of the same tag as a PackedForward message.
+	BatchPackedForward
+	// BatchCompressedPackedForward sends the entries of the same tag
+	// as a gzip-compressed PackedForward message. See Config.CompressThreshold.
+	BatchCompressedPackedForward
+)
+
+const (
+	defaultMaxBatchSize  = 100
+	defaultFlushInterval = time.Second
+)
+
+// batchConfig returns the max number of the entries in the batch and the flush interval.
+func batchConfig(conf Config) (int, time.Duration) {
+	size := conf.MaxBatchSize
+	if size <= 0 {
+		size = defaultMaxBatchSize
+	}
+	interval := conf.FlushInterval
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	return size, interval
+}
+
+// batchWorker is the worker of the async mode with Config.BatchMode,
+// which accumulates the events per tag and sends them together.
+func (hook *FluentHook) batchWorker(queue <-chan *event) {
+	defer close(hook.done)
+
+	maxSize, interval := batchConfig(hook.conf)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	batches := make(map[string][]*event)
+	var tags []string // the order of the first entry of the batches
+	flush := func() {
+		for _, tag := range tags {
+			hook.deliverBatch(tag, batches[tag])
+			delete(batches, tag)
+		}
+		tags = tags[:0]
+	}
+
+	for {
+		select {
+		case ev, ok := <-queue:
+			switch {
+			case !ok:
+				flush()
+				return
+			case ev.flushed != nil:
+				flush()
+				close(ev.flushed)
+			case len(ev.options) > 0:
+				// the options are of the message, so it's sent alone.
+				hook.deliver(ev)
+			default:
+				b, ok := batches[ev.tag]
+				if !ok {
+					tags = append(tags, ev.tag)
+				}
+				b = append(b, ev)
+				if len(b) < maxSize {
+					batches[ev.tag] = b
+					continue
+				}
+				hook.deliverBatch(ev.tag, b)
+				delete(batches, ev.tag)
+				for i, tag := range tags {
+					if tag == ev.tag {
+						tags = append(tags[:i], tags[i+1:]...)
+						break
+					}
+				}
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// newBatchMessage returns the forward message of the batched events.
+// The entries always have the entry time as EventTime.
+func (hook *FluentHook) newBatchMessage(ev *event) (protocol.ChunkEncoder, error) {
+	entries := make(protocol.EntryList, len(ev.batch))
+	for i, e := range ev.batch {
+		entries[i] = protocol.EntryExt{
+			Timestamp: protocol.EventTime{Time: e.time},
+			Record:    hook.encodedRecord(e.record),
+		}
+	}
+	if hook.conf.BatchMode == BatchForward {
+		return protocol.NewForwardMessage(ev.tag, entries), nil
+	}
+
+	// the entries are packed here, as EntryList.MarshalPacked returns the pooled buffer.
+	var buf bytes.Buffer
+	for _, e := range entries {
+		if err := msgp.Encode(&buf, e); err != nil {
+			return nil, err
+		}
+	}
+	stream := buf.Bytes()
+	size := len(entries)
+	opts := &protocol.MessageOptions{Size: &size}
+	if hook.conf.BatchMode == BatchCompressedPackedForward && len(stream) >= hook.conf.CompressThreshold {
+		var zbuf bytes.Buffer
+		zw := gzip.NewWriter(&zbuf)
+		if _, err := zw.Write(stream); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		stream = zbuf.Bytes()
+		opts.Compressed = "gzip"
+	}
+	return &protocol.PackedForwardMessage{
+		Tag:         ev.tag,
+		EventStream: stream,
+		Options:     opts,
+	}, nil
+}
@@ -0,0 +1,196 @@
+package logrus_fluent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/fluent-forward-go/fluent/protocol"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tinylib/msgp/msgp"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
+)
+
+func TestBatchConfig(t *testing.T) {
+	a := assert.New(t)
+
+	size, interval := batchConfig(Config{})
+	a.Equal(defaultMaxBatchSize, size)
+	a.Equal(defaultFlushInterval, interval)
+
+	size, interval = batchConfig(Config{MaxBatchSize: 10, FlushInterval: time.Minute})
+	a.Equal(10, size)
+	a.Equal(time.Minute, interval)
+}
+
+func TestBatchMode(t *testing.T) {
+	for _, mode := range []BatchMode{BatchForward, BatchPackedForward, BatchCompressedPackedForward} {
+		a := assert.New(t)
+
+		port, batches := newBatchServer(t, mode)
+		hook, err := NewWithConfig(Config{
+			Host:            testHOST,
+			Port:            port,
+			AsyncBufferSize: 10,
+			BatchMode:       mode,
+			MaxBatchSize:    3,
+			FlushInterval:   time.Hour,
+		})
+		a.NoError(err)
+
+		// the batch is sent when it's full.
+		for i := 0; i < 3; i++ {
+			a.NoError(hook.Fire(newEntry(logrus.Fields{"value": i}, entryMessage)))
+		}
+		b := receiveBatch(t, batches)
+		a.Equal(entryMessage, b.Tag, mode)
+		if a.Len(b.Entries, 3, mode) {
+			for i, e := range b.Entries {
+				a.EqualValues(i, e.Record.(map[string]interface{})["value"], mode)
+			}
+		}
+
+		// the rest is sent by Flush.
+		a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+		a.NoError(hook.Flush(context.Background()))
+		a.Len(receiveBatch(t, batches).Entries, 1, mode)
+		a.NoError(hook.Close())
+		a.EqualValues(4, hook.Stats().Sent, mode)
+	}
+}
+
+func TestBatchFlushInterval(t *testing.T) {
+	a := assert.New(t)
+
+	port, batches := newBatchServer(t, BatchForward)
+	hook, err := NewWithConfig(Config{
+		Host:            testHOST,
+		Port:            port,
+		AsyncBufferSize: 10,
+		BatchMode:       BatchForward,
+		FlushInterval:   10 * time.Millisecond,
+	})
+	a.NoError(err)
+	defer hook.Close()
+
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.NoError(hook.Fire(newEntry(nil, staticTag)))
+	tags := []string{receiveBatch(t, batches).Tag, receiveBatch(t, batches).Tag}
+	a.ElementsMatch([]string{entryMessage, staticTag}, tags)
+}
+
+type receivedBatch struct {
+	Tag     string
+	Entries protocol.EntryList
+}
+
+// newBatchServer starts mock server which decodes every received forward message.
+func newBatchServer(t *testing.T, mode BatchMode) (int, chan receivedBatch) {
+	l, err := net.Listen("tcp", testHOST+":0")
+	if err != nil {
+		t.Fatalf("Error listening: %s", err.Error())
+	}
+	t.Cleanup(func() { l.Close() })
+
+	batches := make(chan receivedBatch, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := msgp.NewReader(conn)
+				for {
+					b, err := decodeBatch(r, mode)
+					if err != nil {
+						return
+					}
+					batches <- b
+				}
+			}()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port, batches
+}
+
+func decodeBatch(r *msgp.Reader, mode BatchMode) (receivedBatch, error) {
+	if mode == BatchForward {
+		var msg protocol.ForwardMessage
+		err := msg.DecodeMsg(r)
+		return receivedBatch{Tag: msg.Tag, Entries: msg.Entries}, err
+	}
+
+	var msg protocol.PackedForwardMessage
+	if err := msg.DecodeMsg(r); err != nil {
+		return receivedBatch{}, err
+	}
+	stream := msg.EventStream
+	if msg.Options != nil && msg.Options.Compressed == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(stream))
+		if err != nil {
+			return receivedBatch{}, err
+		}
+		if stream, err = io.ReadAll(zr); err != nil {
+			return receivedBatch{}, err
+		}
+	}
+	b := receivedBatch{Tag: msg.Tag}
+	_, err := b.Entries.UnmarshalPacked(stream)
+	return b, err
+}
+
+func receiveBatch(t *testing.T, batches chan receivedBatch) receivedBatch {
+	select {
+	case b := <-batches:
+		return b
+	case <-time.After(time.Second):
+		t.Fatalf("batch is not received")
+	}
+	return receivedBatch{}
+}
+
+func TestCompressPayload(t *testing.T) {
+	a := assert.New(t)
+
+	server, err := testutil.NewServer()
+	a.NoError(err)
+	defer server.Close()
+
+	hook, err := NewWithConfig(Config{
+		Host:              server.Host(),
+		Port:              server.Port(),
+		AsyncBufferSize:   10,
+		CompressPayload:   true,
+		CompressThreshold: 256,
+		FlushInterval:     time.Hour,
+	})
+	a.NoError(err)
+	defer hook.Close()
+
+	// the tiny batch is not compressed.
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.NoError(hook.Flush(context.Background()))
+	events, err := server.WaitEvents(1, time.Second)
+	a.NoError(err)
+	a.NotContains(events[0].Options, "compressed")
+	a.EqualValues(1, events[0].Options["size"])
+
+	server.Reset()
+	for i := 0; i < 3; i++ {
+		a.NoError(hook.Fire(newEntry(logrus.Fields{"value": strings.Repeat("x", 100)}, entryMessage)))
+	}
+	a.NoError(hook.Flush(context.Background()))
+	events, err = server.WaitEvents(3, time.Second)
+	a.NoError(err)
+	a.Equal("gzip", events[0].Options["compressed"])
+	a.Equal(strings.Repeat("x", 100), events[2].Record["value"])
+}
@@ -0,0 +1,138 @@
+package logrus_fluent
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen is the error of the records rejected while the circuit breaker is open.
+var ErrBreakerOpen = errors.New("logrus_fluent: circuit breaker is open")
+
+// DefaultBreakerCooldown is the default duration of the open circuit breaker.
+const DefaultBreakerCooldown = 30 * time.Second
+
+// BreakerState is the state of the circuit breaker, see Config.BreakerThreshold.
+type BreakerState int
+
+const (
+	// BreakerClosed sends the records as usual.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects the records without sending them until the cooldown passes.
+	BreakerOpen
+	// BreakerHalfOpen sends one record to check the recovery, and the others are rejected.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// breaker stops sending after the consecutive failures for the cooldown,
+// so the callers aren't blocked by the dead endpoints on every log.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	onChange  func(from, to BreakerState)
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+// newBreaker returns the circuit breaker, or nil when it's disabled.
+func newBreaker(conf Config) *breaker {
+	if conf.BreakerThreshold <= 0 {
+		return nil
+	}
+	cooldown := conf.BreakerCooldown
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+	return &breaker{
+		threshold: conf.BreakerThreshold,
+		cooldown:  cooldown,
+		onChange:  conf.OnBreakerStateChange,
+		now:       time.Now,
+	}
+}
+
+// allow reports whether the record can be sent. It always allows on nil.
+// The open breaker becomes half-open after the cooldown, and allows only one probe.
+func (b *breaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	from := b.state
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			b.mu.Unlock()
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+	case BreakerHalfOpen:
+		if b.probing {
+			b.mu.Unlock()
+			return false
+		}
+		b.probing = true
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.changed(from, to)
+	return true
+}
+
+// done records the result of the allowed send. It does nothing on nil.
+func (b *breaker) done(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	from := b.state
+	b.probing = false
+	if err == nil {
+		b.failures = 0
+		b.state = BreakerClosed
+	} else {
+		b.failures++
+		if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+			b.state = BreakerOpen
+			b.openedAt = b.now()
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.changed(from, to)
+}
+
+// currentState returns the state. The nil breaker is always closed.
+func (b *breaker) currentState() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *breaker) changed(from, to BreakerState) {
+	if from != to && b.onChange != nil {
+		b.onChange(from, to)
+	}
+}
@@ -0,0 +1,87 @@
+package logrus_fluent
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
+)
+
+func TestBreaker(t *testing.T) {
+	a := assert.New(t)
+
+	a.Nil(newBreaker(Config{}))
+	var transitions []BreakerState
+	b := newBreaker(Config{
+		BreakerThreshold:     2,
+		BreakerCooldown:      time.Second,
+		OnBreakerStateChange: func(from, to BreakerState) { transitions = append(transitions, to) },
+	})
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	sendErr := errors.New("send error")
+
+	a.True(b.allow())
+	b.done(sendErr)
+	a.Equal(BreakerClosed, b.currentState())
+	a.True(b.allow())
+	b.done(sendErr)
+	a.Equal(BreakerOpen, b.currentState())
+	a.False(b.allow())
+
+	// one probe after the cooldown, and it fails.
+	now = now.Add(time.Second)
+	a.True(b.allow())
+	a.False(b.allow())
+	b.done(sendErr)
+	a.Equal(BreakerOpen, b.currentState())
+	a.False(b.allow())
+
+	// the probe succeeds.
+	now = now.Add(time.Second)
+	a.True(b.allow())
+	b.done(nil)
+	a.Equal(BreakerClosed, b.currentState())
+	a.True(b.allow())
+
+	a.Equal([]BreakerState{BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed}, transitions)
+}
+
+func TestBreakerThreshold(t *testing.T) {
+	a := assert.New(t)
+
+	sender := testutil.NewMockSender()
+	sender.SetError(errors.New("send error"))
+	var fallbacks int
+	hook, err := NewWithConfig(Config{
+		Sender:           sender,
+		DefaultTag:       staticTag,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+		OnError:          func(err error, tag string, data logrus.Fields) { fallbacks++ },
+	})
+	a.NoError(err)
+
+	a.Error(hook.Fire(newEntry(nil, entryMessage)))
+	a.Error(hook.Fire(newEntry(nil, entryMessage)))
+	a.ErrorIs(hook.Fire(newEntry(nil, entryMessage)), ErrBreakerOpen)
+	a.Equal(3, fallbacks)
+
+	stats := hook.Stats()
+	a.EqualValues(2, stats.Failed)
+	a.EqualValues(1, stats.BreakerRejected)
+	a.Equal(BreakerOpen, stats.BreakerState)
+
+	// the fatal entries bypass the open breaker, and don't change it.
+	sender.SetError(nil)
+	entry := newEntry(nil, entryMessage)
+	entry.Level = logrus.FatalLevel
+	a.NoError(hook.Fire(entry))
+	a.Len(sender.Messages(), 1)
+	a.ErrorIs(hook.Fire(newEntry(nil, entryMessage)), ErrBreakerOpen)
+	a.Equal(BreakerOpen, hook.Stats().BreakerState)
+}
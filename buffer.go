@@ -0,0 +1,175 @@
+package logrus_fluent
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// bufferFileExt is the extension of the chunk files in Config.BufferPath.
+const bufferFileExt = ".msgpack"
+
+// diskBuffer is the persistent queue of the async mode, see Config.BufferPath.
+// Every event is written into the chunk file before it's queued,
+// and the file is removed after the event is sent.
+type diskBuffer struct {
+	dir string
+	seq atomic.Uint64
+}
+
+func newDiskBuffer(dir string) (*diskBuffer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &diskBuffer{dir: dir}, nil
+}
+
+// write writes the event into the new chunk file, and sets the file to the event.
+// The file is renamed after it's written, so the partial chunk is never replayed.
+func (b *diskBuffer) write(ev *event) error {
+	name := fmt.Sprintf("%020d-%010d%s", time.Now().UnixNano(), b.seq.Add(1), bufferFileExt)
+	path := filepath.Join(b.dir, name)
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	w := msgp.NewWriter(f)
+	err = encodeBufferedEvent(w, ev)
+	if err == nil {
+		err = w.Flush()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	ev.file = path
+	return nil
+}
+
+// remove removes the chunk file of the event, if any. It does nothing on nil.
+func (b *diskBuffer) remove(ev *event) {
+	if b == nil || ev.file == "" {
+		return
+	}
+	os.Remove(ev.file)
+	ev.file = ""
+}
+
+// load reads the chunk files left by the previous process, in the written order.
+// The broken chunk is removed, as it can never be sent.
+func (b *diskBuffer) load() ([]*event, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		switch name := e.Name(); {
+		case e.IsDir():
+		case strings.HasSuffix(name, bufferFileExt+".tmp"):
+			os.Remove(filepath.Join(b.dir, name))
+		case strings.HasSuffix(name, bufferFileExt):
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	events := make([]*event, 0, len(names))
+	for _, name := range names {
+		path := filepath.Join(b.dir, name)
+		ev, err := readBufferedEvent(path)
+		if err != nil {
+			os.Remove(path)
+			continue
+		}
+		ev.file = path
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// encodeBufferedEvent writes the event as [tag, time, level, record, options].
+func encodeBufferedEvent(w *msgp.Writer, ev *event) error {
+	if err := w.WriteArrayHeader(5); err != nil {
+		return err
+	}
+	if err := w.WriteString(ev.tag); err != nil {
+		return err
+	}
+	if err := w.WriteInt64(ev.time.UnixNano()); err != nil {
+		return err
+	}
+	if err := w.WriteUint32(uint32(ev.level)); err != nil {
+		return err
+	}
+	if err := w.WriteIntf(ev.record); err != nil {
+		return err
+	}
+	return w.WriteMapStrStr(ev.options)
+}
+
+func readBufferedEvent(path string) (*event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := msgp.NewReader(bufio.NewReader(f))
+
+	if _, err := r.ReadArrayHeader(); err != nil {
+		return nil, err
+	}
+	ev := &event{}
+	if ev.tag, err = r.ReadString(); err != nil {
+		return nil, err
+	}
+	nsec, err := r.ReadInt64()
+	if err != nil {
+		return nil, err
+	}
+	ev.time = time.Unix(0, nsec)
+	level, err := r.ReadUint32()
+	if err != nil {
+		return nil, err
+	}
+	ev.level = logrus.Level(level)
+	if ev.record, err = r.ReadIntf(); err != nil {
+		return nil, err
+	}
+	if data, ok := ev.record.(map[string]interface{}); ok {
+		ev.data = data
+	}
+	n, err := r.ReadMapHeader()
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		ev.options = make(map[string]string, n)
+	}
+	for i := uint32(0); i < n; i++ {
+		k, err := r.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		if ev.options[k], err = r.ReadString(); err != nil {
+			return nil, err
+		}
+	}
+	return ev, nil
+}
@@ -0,0 +1,90 @@
+package logrus_fluent
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
+)
+
+func TestDiskBuffer(t *testing.T) {
+	a := assert.New(t)
+
+	b, err := newDiskBuffer(t.TempDir())
+	a.NoError(err)
+
+	now := time.Now()
+	events := []*event{
+		{tag: staticTag, time: now, level: logrus.WarnLevel, record: map[string]interface{}{"value": fieldValue}},
+		{tag: entryMessage, time: now, level: logrus.InfoLevel, record: map[string]interface{}{}, options: map[string]string{"chunk": "id"}},
+	}
+	for _, ev := range events {
+		a.NoError(b.write(ev))
+		a.NotEmpty(ev.file)
+	}
+
+	loaded, err := b.load()
+	a.NoError(err)
+	if a.Len(loaded, 2) {
+		a.Equal(staticTag, loaded[0].tag)
+		a.True(now.Equal(loaded[0].time))
+		a.Equal(logrus.WarnLevel, loaded[0].level)
+		a.Equal(fieldValue, loaded[0].record.(map[string]interface{})["value"])
+		a.Equal(fieldValue, loaded[0].data["value"])
+		a.Equal(map[string]string{"chunk": "id"}, loaded[1].options)
+	}
+
+	b.remove(loaded[0])
+	_, err = os.Stat(events[0].file)
+	a.True(os.IsNotExist(err))
+	loaded, err = b.load()
+	a.NoError(err)
+	a.Len(loaded, 1)
+}
+
+func TestBufferPath(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+
+	sender := testutil.NewMockSender()
+	sender.SetError(errors.New("send error"))
+	hook, err := NewWithConfig(Config{
+		Sender:          sender,
+		DefaultTag:      staticTag,
+		AsyncBufferSize: 10,
+		BufferPath:      dir,
+	})
+	a.NoError(err)
+	for i := 0; i < 3; i++ {
+		a.NoError(hook.Fire(newEntry(logrus.Fields{"value": i}, entryMessage)))
+	}
+	a.NoError(hook.Close())
+	a.EqualValues(3, hook.Stats().Failed)
+	files, _ := os.ReadDir(dir)
+	a.Len(files, 3)
+
+	// the failed entries are replayed before the new ones.
+	sender = testutil.NewMockSender()
+	hook, err = NewWithConfig(Config{
+		Sender:          sender,
+		DefaultTag:      staticTag,
+		AsyncBufferSize: 10,
+		BufferPath:      dir,
+	})
+	a.NoError(err)
+	a.NoError(hook.Fire(newEntry(logrus.Fields{"value": 3}, entryMessage)))
+	a.NoError(hook.Close())
+	if messages := sender.Messages(); a.Len(messages, 4) {
+		for i, m := range messages {
+			a.Equal(staticTag, m.Tag)
+			a.EqualValues(i, m.Record.(map[string]interface{})["value"])
+		}
+	}
+	files, _ = os.ReadDir(dir)
+	a.Empty(files)
+}
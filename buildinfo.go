@@ -0,0 +1,46 @@
+package logrus_fluent
+
+import (
+	"runtime/debug"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// BuildVersionField is the default field name of the main module version.
+	BuildVersionField = "service.version"
+	// BuildRevisionField is the default field name of the VCS revision.
+	BuildRevisionField = "vcs.revision"
+)
+
+// readBuildInfoFields returns the version fields from the build info of the binary.
+// Nothing is returned when the build info is unavailable.
+func readBuildInfoFields(versionField, revisionField string) logrus.Fields {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+	return buildInfoFields(info, versionField, revisionField)
+}
+
+// buildInfoFields returns the main module version and the VCS revision in the build info.
+func buildInfoFields(info *debug.BuildInfo, versionField, revisionField string) logrus.Fields {
+	if versionField == "" {
+		versionField = BuildVersionField
+	}
+	if revisionField == "" {
+		revisionField = BuildRevisionField
+	}
+
+	fields := make(logrus.Fields)
+	// "(devel)" is set when the binary is built by `go run` or `go build` in the module.
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		fields[versionField] = v
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && s.Value != "" {
+			fields[revisionField] = s.Value
+		}
+	}
+	return fields
+}
@@ -0,0 +1,34 @@
+package logrus_fluent
+
+import (
+	"runtime/debug"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildInfoFields(t *testing.T) {
+	a := assert.New(t)
+
+	info := &debug.BuildInfo{
+		Main: debug.Module{Version: "v1.2.3"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs", Value: "git"},
+			{Key: "vcs.revision", Value: "abcdef"},
+		},
+	}
+	a.Equal(logrus.Fields{
+		BuildVersionField:  "v1.2.3",
+		BuildRevisionField: "abcdef",
+	}, buildInfoFields(info, "", ""))
+	a.Equal(logrus.Fields{
+		"version":  "v1.2.3",
+		"revision": "abcdef",
+	}, buildInfoFields(info, "version", "revision"))
+
+	info = &debug.BuildInfo{
+		Main: debug.Module{Version: "(devel)"},
+	}
+	a.Empty(buildInfoFields(info, "", ""))
+}
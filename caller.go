@@ -0,0 +1,42 @@
+package logrus_fluent
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// CallerFileField is the default field name of the caller file.
+	CallerFileField = logrus.FieldKeyFile
+	// CallerLineField is the default field name of the caller line.
+	CallerLineField = "line"
+	// CallerFunctionField is the default field name of the caller function.
+	CallerFunctionField = logrus.FieldKeyFunc
+)
+
+// setCallerFields adds the caller of the entry reported by logrus.
+// The fields in the entry are not overwritten.
+func (hook *FluentHook) setCallerFields(entry *logrus.Entry, data logrus.Fields) {
+	if !hook.conf.IncludeCaller || entry.Caller == nil {
+		return
+	}
+
+	fields := logrus.Fields{
+		CallerFileField:     strings.TrimPrefix(entry.Caller.File, hook.conf.CallerTrimPrefix),
+		CallerLineField:     entry.Caller.Line,
+		CallerFunctionField: entry.Caller.Function,
+	}
+	for k, v := range fields {
+		if name, ok := hook.conf.CallerFieldNames[k]; ok {
+			k = name
+		}
+		if _, ok := hook.ignoreFields[k]; ok {
+			continue
+		}
+		if _, ok := data[k]; ok {
+			continue
+		}
+		data[k] = v
+	}
+}
@@ -0,0 +1,67 @@
+package logrus_fluent
+
+import (
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetCallerFields(t *testing.T) {
+	a := assert.New(t)
+
+	caller := &runtime.Frame{File: "main.go", Line: 42, Function: "main.main"}
+	hook := &FluentHook{
+		conf: Config{
+			IncludeCaller:    true,
+			CallerFieldNames: map[string]string{CallerFileField: "caller.file"},
+		},
+		ignoreFields: map[string]struct{}{CallerFunctionField: {}},
+	}
+
+	data := logrus.Fields{}
+	hook.setCallerFields(&logrus.Entry{Caller: caller}, data)
+	a.Equal(logrus.Fields{"caller.file": "main.go", CallerLineField: 42}, data)
+
+	data = logrus.Fields{CallerLineField: "original"}
+	hook.setCallerFields(&logrus.Entry{Caller: caller}, data)
+	a.Equal("original", data[CallerLineField])
+
+	hook.conf.CallerTrimPrefix = "/src/app/"
+	data = logrus.Fields{}
+	hook.setCallerFields(&logrus.Entry{Caller: &runtime.Frame{File: "/src/app/cmd/main.go"}}, data)
+	a.Equal("cmd/main.go", data["caller.file"])
+
+	data = logrus.Fields{}
+	hook.setCallerFields(&logrus.Entry{}, data)
+	a.Empty(data)
+
+	hook.conf.IncludeCaller = false
+	hook.setCallerFields(&logrus.Entry{Caller: caller}, data)
+	a.Empty(data)
+}
+
+func TestIncludeCaller(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:          testHOST,
+		Port:          port,
+		IncludeCaller: true,
+	})
+	a.NoError(err)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.SetReportCaller(true)
+	logger.AddHook(hook)
+	logger.Error(entryMessage)
+
+	msg := receiveMessage(t, messages)
+	a.Contains(msg.Record[CallerFileField], "caller_test.go")
+	a.NotZero(msg.Record[CallerLineField])
+	a.Contains(msg.Record[CallerFunctionField], "TestIncludeCaller")
+}
@@ -1,8 +1,14 @@
 package logrus_fluent
 
 import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
 	"time"
 
+	"github.com/IBM/fluent-forward-go/fluent/client"
 	"github.com/sirupsen/logrus"
 )
 
@@ -10,26 +16,411 @@ import (
 type Config struct {
 	Port                  int
 	Host                  string
+	SocketPath            string       // path of the unix domain socket, used instead of Host and Port.
+	Hosts                 []string     // addresses ("host:port") of fluentd aggregators, used instead of Host and Port.
+	Sender                FluentSender // used instead of the connections, and connected by NewWithConfig.
 	LogLevels             []logrus.Level
-	DisableConnectionPool bool // Fluent client will be created every logging if true.
+	MinLevel              logrus.Level // the least severe level fired, e.g. TraceLevel, used without LogLevels.
+	DisableConnectionPool bool         // the connection is deferred until the first logging, like LazyConnect.
+	DialPerSend           bool         // Fluent client will be created and connected every logging if true.
 	DefaultTag            string
 	DefaultMessageField   string
 	DefaultIgnoreFields   map[string]struct{}
 	DefaultFilters        map[string]func(interface{}) interface{}
+	RecordTagAs           string // resolved fluentd tag is added to the record with this field name if set.
+
+	// SyncLevels are the levels always sent synchronously, bypassing any buffering.
+	// (default: PanicLevel and FatalLevel)
+	// PanicLevel and FatalLevel are sent synchronously even if they aren't listed.
+	// They're sent after the buffered entries, and the connection is flushed before Fire returns.
+	SyncLevels []logrus.Level
+
+	// ErrorFormat is used for error values in the log fields.
+	ErrorFormat ErrorFormat
+
+	// MaxFields is the max number of the log fields, excluding tag, level and message. (0 is unlimited)
+	// FieldOverflowPolicy decides how the overflow fields are handled,
+	// and MaxOverflowFields limits the number of the collapsed fields. (0 is unlimited)
+	MaxFields           int
+	FieldOverflowPolicy FieldOverflowPolicy
+	MaxOverflowFields   int
+
+	// MaxMessageSize is the max size of the record encoded in msgpack, in bytes. (0 is unlimited)
+	// MessageSizePolicy decides how the larger record is cut. The record which can't be cut enough
+	// is dropped with ErrMessageTooLarge like the failed send, and counted in Stats.Oversized.
+	MaxMessageSize    int
+	MessageSizePolicy MessageSizePolicy
+
+	// MaxChunkSize is the max size of the forward message in bytes, e.g. chunk_limit_size of fluentd. (0 is unlimited)
+	// The batch over it is split into several messages, by the estimated size of the entries.
+	// SplitLargeRecords moves the largest fields of the record over it into the follow-up records,
+	// which have the same RecordIDField, instead of failing the send. The string too large for one record
+	// is split into the parts numbered in SplitPartField. MaxMessageSize is applied after the split.
+	MaxChunkSize      int
+	SplitLargeRecords bool
+
+	// ContextExtractors add the fields extracted from entry.Context.
+	// DefaultContext is used instead when entry.Context is nil,
+	// so the entry context always wins when present.
+	ContextExtractors []func(ctx context.Context) logrus.Fields
+	DefaultContext    context.Context
+
+	// TraceContextFunc adds the trace and span IDs of entry.Context (or DefaultContext) to correlate the logs with the traces.
+	// The field names are TraceIDField and SpanIDField unless configured.
+	TraceContextFunc TraceContextFunc
+	TraceIDField     string
+	SpanIDField      string
+
+	// LevelField is the field name of the log level. (default: "level")
+	// LevelFormat is the format of the level, e.g. LevelFormatUpper or LevelFormatOmit.
+	// LevelAsNumber is the same as LevelFormatSyslog.
+	LevelField    string
+	LevelFormat   LevelFormat
+	LevelAsNumber bool
+
+	// MessageFieldMode decides how entry.Message is set into the record,
+	// e.g. MessageFieldOmitEmpty or MessageFieldLog.
+	// MessageTemplate is the message of MessageFieldTemplate, e.g. "[{field:component}] {message}",
+	// with the placeholders of TagTemplate.
+	MessageFieldMode MessageFieldMode
+	MessageTemplate  string
+
+	// FieldRenames renames the log fields without the struct tags, e.g. {"err": "error.message"}.
+	// The fields are renamed after the ignore fields and the filters, so AccumulateField uses the new names.
+	FieldRenames map[string]string
+
+	// AllowedFields forwards only these fields of the entry, besides the tag, message and level fields,
+	// for the compliance which requires the allow-list instead of AddIgnore. (nil forwards all of them)
+	// The other fields are dropped, or moved into the map of ExtraField if set, e.g. "extra".
+	// The fields added by the hook, e.g. StaticFields and the caller, are always forwarded. See also SetAllowList.
+	AllowedFields []string
+	ExtraField    string
+
+	// KeyTransformer transforms the keys of the log fields after the ignore fields and the filters,
+	// e.g. ToSnakeCase and ToLower. When the keys collide, the last key in sorted order wins.
+	KeyTransformer func(key string) string
+
+	// KeySanitizer replaces all of the keys in the record just before the send,
+	// including the keys of the nested maps and the fields added by the hook,
+	// e.g. SanitizeDots and SanitizeElasticsearch. When the keys collide, the last key in sorted order wins.
+	KeySanitizer func(key string) string
+
+	// TimestampField adds the entry time into the record with this name, e.g. "@timestamp".
+	// TimestampFormat is the layout of the time (default: time.RFC3339Nano),
+	// or the epoch time of TimestampEpochSeconds, TimestampEpochMillis and TimestampEpochNanos.
+	TimestampField  string
+	TimestampFormat string
+
+	// IncludeCaller adds the file, line and function of the caller
+	// when logrus reports it. (see logrus.SetReportCaller)
+	// CallerFieldNames renames the default field names, e.g. {CallerFileField: "caller.file"}.
+	// CallerTrimPrefix is trimmed from the file path, e.g. the root directory of the module.
+	IncludeCaller    bool
+	CallerFieldNames map[string]string
+	CallerTrimPrefix string
+
+	// ECS renames and nests the standard fields into Elastic Common Schema,
+	// and adds @timestamp and host.name fields.
+	// ECSFieldNames overrides the preset names, "level" => "log.level" and "error" => "error.message".
+	ECS           bool
+	ECSFieldNames map[string]string
+
+	// WrapBytes modifies the serialized message just before it is written to the connection.
+	// (e.g. signing, encryption or custom framing)
+	// The message is encoded by the hook and sent as raw bytes when this is set.
+	// Fire returns the error if WrapBytes returns it.
+	WrapBytes func([]byte) ([]byte, error)
+
+	// Fallback receives the JSON encoded record when the send to fluentd is failed.
+	// (e.g. os.Stderr or a local file)
+	// FallbackLevels limits the levels written into Fallback. (default: all levels)
+	// FallbackMarkError adds "error" with the cause of the failure into the JSON line.
+	Fallback          io.Writer
+	FallbackLevels    []logrus.Level
+	FallbackMarkError bool
+
+	// MirrorOutputs receive every record to send to fluentd as the JSON line of Fallback,
+	// e.g. os.Stdout in development or a local file in canary environments.
+	// MirrorSenders also send every record, and they're connected by NewWithConfig and disconnected by Close.
+	// The records are mirrored when they're sent, i.e. by the worker in the async mode,
+	// so the records dropped from the full buffer aren't mirrored. The failures of the mirrors are ignored.
+	MirrorOutputs []io.Writer
+	MirrorSenders []FluentSender
+
+	// AccumulateField is the set of field names which always have array values.
+	// Use AppendField to add values into the field instead of WithField,
+	// and the non-array value set by WithField is sent as an array with one element.
+	AccumulateField map[string]bool
+
+	// WriteBufferSize enables the buffered writer for the connection to reduce syscalls.
+	// The buffer is flushed when it's full, every WriteFlushInterval (default: 1s),
+	// and before the connection is closed.
+	WriteBufferSize    int
+	WriteFlushInterval time.Duration
+
+	// LoadBalancing decides how the endpoints in Hosts are used.
+	// The endpoint failed to send is skipped until the health check reconnects it,
+	// which runs every HealthCheckInterval. (default: 10s)
+	// When HealthCheckInterval is set, the health check also probes the healthy endpoints,
+	// even if Hosts isn't used. (see Ping and Stats.EndpointsDown)
+	LoadBalancing       LoadBalancing
+	HealthCheckInterval time.Duration
+
+	// TagTemplate builds fluentd tag from the entry, e.g. "myapp.{field:env}.{level}".
+	// {level}, {message} and {field:key} are replaced, and the missing field is empty.
+	// It takes precedence over the tag field and TagRoutes, but not over the static tag.
+	TagTemplate string
+
+	// TagByLevel publishes the entries of the level under the tag, e.g. "audit.security" for WarnLevel.
+	// TagByLevelDefault is used for the other levels if set, otherwise they fall back to the usual tag.
+	// They take precedence over all of the other tags, including the static tag and the tag field.
+	TagByLevel        map[logrus.Level]string
+	TagByLevelDefault string
+
+	// TagLevelSuffix appends the level to the tag, e.g. "myapp.error" and "myapp.info".
+	TagLevelSuffix bool
+
+	// TagFunc computes fluentd tag per entry, e.g. from the level or the fields.
+	// The empty result falls back to TagTemplate, the tag field and TagRoutes.
+	// It takes precedence over them, but not over the static tag.
+	TagFunc func(entry *logrus.Entry) string
+
+	// TagRoutes decide fluentd tag from the log fields, evaluated in order.
+	// TagRouteDefault is used when no route matches.
+	// These are used when the static tag and the tag field are missing.
+	TagRoutes       []TagRoute
+	TagRouteDefault string
+
+	// AddBuildVersion adds the main module version and the VCS revision from the build info.
+	// The field names are BuildVersionField and BuildRevisionField unless configured.
+	AddBuildVersion    bool
+	BuildVersionField  string
+	BuildRevisionField string
+
+	// IncludeHostname and IncludeProcessInfo add HostnameField and PIDField.
+	// StaticFields are added into every record, e.g. the service name, and override them.
+	// These are computed once on the hook creation, and the fields in the entry win.
+	IncludeHostname    bool
+	IncludeProcessInfo bool
+	StaticFields       map[string]interface{}
+
+	// LevelFields are added into the records of the level before the customizers, e.g. {"alert": true} for ErrorLevel.
+	// TagFields are added into the records of the tag after the tag is decided, e.g. the environment labels.
+	// Like StaticFields, the fields in the entry win.
+	LevelFields map[logrus.Level]logrus.Fields
+	TagFields   map[string]logrus.Fields
+
+	// RecordBudget limits the depth, array length, number of fields and size of the record.
+	RecordBudget RecordBudget
+
+	// DisableMarshalers converts the values by the reflection even if they implement
+	// json.Marshaler, encoding.TextMarshaler or fmt.Stringer.
+	DisableMarshalers bool
+
+	// FlattenFields flattens the nested maps and structs of the record into the keys
+	// joined with FlattenSeparator (default: DefaultFlattenSeparator), e.g. {"http": {"status": 200}} => {"http.status": 200}.
+	// The keys are flattened after KeySanitizer. The slices are kept as they are.
+	FlattenFields    bool
+	FlattenSeparator string
+
+	// ContentHashField adds SHA-256 hash of the tag and the record with this field name,
+	// to deduplicate the retried events in downstream.
+	// ContentHashExclude is the volatile field names excluded from the hash.
+	// (default: DefaultContentHashExclude)
+	// TimestampField and RecordIDField are always excluded.
+	ContentHashField   string
+	ContentHashExclude []string
+
+	// ConnectionOptions is the base options of the fluentd client, e.g. the custom Factory.
+	// The zero fields are filled by this config, and the address and TLS config
+	// are filled when the Factory is *client.ConnFactory.
+	ConnectionOptions *client.ConnectionOptions
+
+	// DialFunc creates the connection to the address instead of net.Dialer,
+	// e.g. the proxy dialer or net.Dialer with the keepalive and the local address.
+	// The TLS handshake is performed on it when TLS is enabled, and Timeout limits both of them.
+	// It's not used with ConnectionOptions.Factory.
+	DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+	// Transport is TransportTCP ("" or "tcp") or TransportWebSocket ("ws").
+	// TransportWebSocket sends the forward messages to URL, e.g. "wss://logs.example.com/fluent",
+	// for fluentd or fluent-bit behind the HTTP(S) ingress or the API gateway, instead of Host and Port.
+	// Headers are sent in the handshake, e.g. Authorization. The TLS options are used for "wss",
+	// and ConnectTimeout (or Timeout) limits the handshake. WriteTimeout and KeepAlive are applied to the websocket,
+	// and NewWithConfig fails with RequireAck or ReadTimeout, which aren't supported over it.
+	// The websocket is used as Sender, so Reload keeps the URL and the connection.
+	Transport string
+	URL       string
+	Headers   http.Header
+
+	// PoolSize is the number of the persistent connections. (default: 1)
+	// Fire uses them by round-robin, and each connection is re-established independently.
+	PoolSize int
+
+	// LazyConnect defers the connection until the first logging.
+	// The connection is shared by all of the goroutines and re-established on the send failure.
+	LazyConnect bool
+
+	// RecordValidator checks the record after all of the modifications and before the send.
+	// The record is not sent when it returns an error, and the error is returned from Fire in *SendError.
+	// (see RequireFields)
+	RecordValidator func(tag string, data logrus.Fields) error
+
+	// AsyncBufferSize enables the async mode when it's greater than 0.
+	// Fire puts the entry into the buffer of this size and returns immediately,
+	// and the background worker sends it. The entry of SyncLevels is sent synchronously.
+	// Async enables it with BufferLimit (default: 8192) as the size instead.
+	// OverflowPolicy decides the behavior when the buffer is full.
+	// Call Close to send the buffered entries before the exit.
+	AsyncBufferSize int
+	Async           bool
+	OverflowPolicy  OverflowPolicy
+
+	// BufferPath is the directory of the persistent buffer of the async mode.
+	// Every entry is written there as a msgpack chunk file before it's buffered,
+	// and the file is removed after the entry is sent (and acknowledged with RequireAck).
+	// The entries left by the previous process, e.g. unsent at the crash or failed to send,
+	// are replayed on NewWithConfig before the new entries.
+	BufferPath string
+
+	// BatchMode sends the entries of the same tag together in the async mode.
+	// The batch is sent when it has MaxBatchSize entries (default: 100),
+	// or every FlushInterval (default: 1s). Entries with the message options are sent alone.
+	BatchMode     BatchMode
+	MaxBatchSize  int
+	FlushInterval time.Duration
+
+	// CompressPayload sends the batches as gzip-compressed PackedForward messages
+	// (BatchCompressedPackedForward) to save the bandwidth, e.g. to the aggregator over WAN.
+	// It enables the batching of the async mode instead of BatchMode.
+	// The batch whose packed entries are smaller than CompressThreshold bytes is sent uncompressed,
+	// as the compression of tiny batches costs more CPU than it saves. (0 compresses every batch)
+	CompressPayload   bool
+	CompressThreshold int
+
+	// OnError is called with *SendError when the record finally fails to send, after the retries,
+	// or is rejected by MaxMessageSize or RecordValidator.
+	// It's called by the background worker in the async mode, and by Fire otherwise.
+	// The callback blocks the sending of the following entries, so it should return quickly.
+	OnError func(err error, tag string, data logrus.Fields)
+
+	// DeadLetterSize keeps the last records which are never sent, e.g. dropped by OverflowPolicy
+	// or failed after the retries, up to this number. (0 is disabled)
+	// Drain them with DeadLetters to persist them elsewhere. See also SetDropHandler.
+	DeadLetterSize int
+
+	// BreakerThreshold opens the circuit breaker after this number of the consecutive failed sends. (0 is disabled)
+	// The open breaker rejects the records with ErrBreakerOpen for BreakerCooldown (default: DefaultBreakerCooldown)
+	// without sending them, then sends one record to check the recovery. The panic and fatal records are always sent.
+	// The rejected records are handled like the failed ones, e.g. written into Fallback, and counted in Stats.BreakerRejected.
+	// OnBreakerStateChange is called on every transition of the state.
+	BreakerThreshold     int
+	BreakerCooldown      time.Duration
+	OnBreakerStateChange func(from, to BreakerState)
+
+	// SampleFunc drops the entry when it returns false.
+	// SampleRate is the ratio of the entries sent, between 0 and 1. (0 is no sampling)
+	// MaxPerSecond limits the number of the entries sent per second. (0 is unlimited)
+	// RateLimitBy applies MaxPerSecond per level or per tag.
+	// The dropped entries are counted in Stats.Sampled, and Panic and Fatal are never dropped.
+	SampleFunc   func(entry *logrus.Entry) bool
+	SampleRate   float64
+	MaxPerSecond int
+	RateLimitBy  RateLimitKey
+
+	// SampleSummaryInterval sends the number of the entries dropped by the sampling
+	// on this interval and on Close, with SampleSummaryTag. (default: DefaultSampleSummaryTag)
+	SampleSummaryInterval time.Duration
+	SampleSummaryTag      string
+
+	// DedupWindow collapses the identical entries, i.e. the same level, tag, message and fields, within this window.
+	// The first entry is sent at once and the duplicates are counted in Stats.Deduplicated.
+	// When the window closes, the last duplicate is sent with the number of the duplicates
+	// in DedupCountField. (default: DefaultDedupCountField)
+	// The fields of ContentHashExclude and TimestampField are ignored in the comparison,
+	// and Panic and Fatal are never collapsed.
+	DedupWindow     time.Duration
+	DedupCountField string
+
+	// MaxRetries is the number of the retries when the sending fails. (0 is no retry)
+	// The connection is re-established before each retry, and the interval
+	// starts from RetryInitialInterval and doubles every retry.
+	MaxRetries           int
+	RetryInitialInterval time.Duration
+
+	// SendTimeout is the max time Fire waits for the entry to be sent, including the retries,
+	// or to be buffered in the async mode. Fire returns context.DeadlineExceeded then.
+	// The send continues in the background, and Close waits for it. (0 is no timeout, see FireContext)
+	SendTimeout time.Duration
+
+	// TLS enables the TLS connection with the config.
+	// TLSEnabled enables it with the default config when TLS is nil.
+	// The server name is verified against Host unless TLS.ServerName is set.
+	TLS        *tls.Config
+	TLSEnabled bool
+
+	// TLSCAFile, TLSCertFile and TLSKeyFile are PEM files of the CA certificates
+	// and the client certificate. These and the other TLS options enable the TLS connection,
+	// and they're applied on top of TLS.
+	TLSCAFile             string
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSInsecureSkipVerify bool
+	TLSServerName         string
+
+	// SharedKey enables the authentication by the handshake with fluentd, and
+	// SelfHostname is sent as the client hostname. (default: os.Hostname)
+	// Username and Password are sent when fluentd requires the user authentication
+	// (user_auth in <security>), with SharedKey. The handshake is done in Timeout if set.
+	// The failed authentication is returned as the connect error.
+	SharedKey    string
+	SelfHostname string
+	Username     string
+	Password     string
+
+	// UseEventTime sends the entry time as EventTime with nanoseconds.
+	// Otherwise the message has the sent time in seconds for the older aggregators.
+	UseEventTime bool
+
+	// SortFields encodes the keys of the record and its nested maps in sorted order,
+	// so the same record is always the same msgpack payload, e.g. for the diffs and the golden tests.
+	// It applies to the messages encoded by the hook, not to the records given to FluentSender.SendMessage.
+	SortFields bool
+
+	// MessageOptions are sent in the option map of the forward message, not in the record.
+	// WithMessageOptions adds the options for each entry.
+	MessageOptions map[string]string
+
+	// RequireAck makes Fire wait for the acknowledgement of fluentd,
+	// and the message is treated as failed (and retried) when it isn't received
+	// within AckTimeout (default: 60s). With WrapBytes, the ack of the chunk option
+	// set before the wrapping is expected.
+	RequireAck bool
+	AckTimeout time.Duration
+
+	// ConnectTimeout is the timeout of the dial and the TLS handshake, Timeout is used if zero.
+	// ReadTimeout is the deadline of every read from the connection, i.e. the ack of RequireAck,
+	// used instead of AckTimeout. With Timeout and WriteTimeout, the stalled fluentd can't block Fire forever.
+	// KeepAlive is the period of the TCP keep-alive probes to detect the dead peer.
+	// (0 is the default of net.Dialer, and negative disables them)
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	KeepAlive      time.Duration
 
 	// from fluent.Config
 	// see https://github.com/fluent/fluent-logger-golang/blob/master/fluent/fluent.go
 	FluentNetwork      string
-	FluentSocketPath   string
-	Timeout            time.Duration
-	WriteTimeout       time.Duration
-	BufferLimit        int
-	RetryWait          int
-	MaxRetry           int
-	TagPrefix          string
+	FluentSocketPath   string        // alias of SocketPath when FluentNetwork is "unix" or empty
+	Timeout            time.Duration // timeout of the dial and the handshakes (0 is no timeout)
+	WriteTimeout       time.Duration // deadline of every write into the connection (0 is no timeout)
+	BufferLimit        int           // buffer size of Async mode, in the number of the entries
+	RetryWait          int           // alias of RetryInitialInterval in milliseconds
+	MaxRetry           int           // alias of MaxRetries
+	MaxRetryWait       int           // max interval of the retries in milliseconds (0 is unlimited)
+	TagPrefix          string        // prepended to every tag with "." separator
 	AsyncConnect       bool
 	MarshalAsJSON      bool
-	SubSecondPrecision bool
+	SubSecondPrecision bool // alias of UseEventTime
 	RequestAck         bool
 }
 
@@ -45,6 +436,7 @@ type Config struct {
 //		BufferLimit:        c.BufferLimit,
 //		RetryWait:          c.RetryWait,
 //		MaxRetry:           c.MaxRetry,
+//		MaxRetryWait:       c.MaxRetryWait,
 //		TagPrefix:          c.TagPrefix,
 //		Async:              c.AsyncConnect,
 //		MarshalAsJSON:      c.MarshalAsJSON,
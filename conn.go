@@ -0,0 +1,540 @@
+package logrus_fluent
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/IBM/fluent-forward-go/fluent/client"
+)
+
+const defaultWriteFlushInterval = time.Second
+
+// newClient returns fluentd client with the connection settings in the config.
+// Config.ConnectionOptions is used as the base, and its zero fields are filled by the config.
+func newClient(conf Config) *client.Client {
+	var opts client.ConnectionOptions
+	if conf.ConnectionOptions != nil {
+		opts = *conf.ConnectionOptions
+	}
+	opts.Factory = newConnFactory(conf, opts.Factory)
+	if !opts.RequireAck {
+		opts.RequireAck = conf.RequireAck || conf.RequestAck
+	}
+	if opts.ConnectionTimeout == 0 {
+		opts.ConnectionTimeout = conf.AckTimeout
+	}
+
+	c := client.New(opts)
+	c.Hostname = conf.SelfHostname
+	if c.Hostname == "" {
+		c.Hostname, _ = os.Hostname()
+	}
+	return c
+}
+
+// connectClient connects the client, and authenticates it with the shared key
+// of ConnectionOptions.AuthInfo if set. (Config.SharedKey is used by connFactory instead)
+func connectClient(c *client.Client) error {
+	if err := c.Connect(); err != nil {
+		return err
+	}
+	return handshake(c)
+}
+
+// reconnectClient re-establishes the connection of the client like connectClient.
+func reconnectClient(c *client.Client) error {
+	if err := c.Reconnect(); err != nil {
+		return err
+	}
+	return handshake(c)
+}
+
+// handshake performs HELO/PING/PONG handshake, and disconnects the client on failure.
+func handshake(c *client.Client) error {
+	if c.AuthInfo.SharedKey == nil {
+		return nil
+	}
+	if err := c.Handshake(); err != nil {
+		c.Disconnect()
+		return err
+	}
+	return nil
+}
+
+// flushClient writes the buffered data of the client connection.
+func flushClient(c *client.Client) error {
+	if f, ok := c.ConnectionFactory.(*connFactory); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// connFactory creates the connection with the settings in the config.
+type connFactory struct {
+	client.ConnectionFactory
+
+	auth               *authInfo // the handshake on every new connection, see Config.SharedKey
+	writeTimeout       time.Duration
+	readTimeout        time.Duration
+	writeBufferSize    int
+	writeFlushInterval time.Duration
+
+	mu   sync.Mutex
+	conn *bufferedConn // the latest buffered connection
+}
+
+// socketPath returns the path of the unix domain socket, or "" to connect with Host and Port.
+func socketPath(conf Config) string {
+	if conf.SocketPath != "" {
+		return conf.SocketPath
+	}
+	if conf.FluentNetwork == "" || conf.FluentNetwork == "unix" {
+		return conf.FluentSocketPath
+	}
+	return ""
+}
+
+// validateTransport checks exactly one of the unix domain socket, Host and Port, and Hosts is set.
+// Host and Port are not required with the custom factory in Config.ConnectionOptions.
+func validateTransport(conf Config) error {
+	hasAddress := conf.Host != "" || conf.Port != 0 || len(conf.Hosts) > 0
+	switch {
+	case len(conf.Hosts) > 0 && (conf.Host != "" || conf.Port != 0):
+		return errors.New("logrus_fluent: both Hosts and Host/Port are specified")
+	case socketPath(conf) != "" && hasAddress:
+		return errors.New("logrus_fluent: both SocketPath and Host/Port are specified")
+	case socketPath(conf) == "" && !hasAddress &&
+		(conf.ConnectionOptions == nil || conf.ConnectionOptions.Factory == nil):
+		return errors.New("logrus_fluent: either SocketPath or Host/Port must be specified")
+	}
+	return nil
+}
+
+// address returns the network and the address to dial.
+func address(conf Config) (string, string) {
+	if path := socketPath(conf); path != "" {
+		return "unix", path
+	}
+	return "tcp", fmt.Sprintf("%s:%d", conf.Host, conf.Port)
+}
+
+// newConnFactory returns the factory which dials with the base factory.
+// The base *client.ConnFactory is copied and its zero address and TLS config are filled,
+// and the other factories are used as they are.
+func newConnFactory(conf Config, base client.ConnectionFactory) *connFactory {
+	switch b := base.(type) {
+	case nil:
+		network, addr := address(conf)
+		dial := conf.DialFunc
+		if dial == nil && conf.KeepAlive != 0 {
+			// client.ConnFactory has no keep-alive setting.
+			dial = (&net.Dialer{KeepAlive: conf.KeepAlive}).DialContext
+		}
+		if dial != nil {
+			base = &dialFuncFactory{
+				dial:      dial,
+				network:   network,
+				address:   addr,
+				tlsConfig: tlsConfig(conf),
+				timeout:   connectTimeout(conf),
+			}
+			break
+		}
+		base = &client.ConnFactory{
+			Network:   network,
+			Address:   addr,
+			TLSConfig: tlsConfig(conf),
+			Timeout:   connectTimeout(conf),
+		}
+	case *client.ConnFactory:
+		cf := *b
+		if cf.Address == "" {
+			cf.Network, cf.Address = address(conf)
+		}
+		if cf.TLSConfig == nil {
+			cf.TLSConfig = tlsConfig(conf)
+		}
+		if cf.Timeout == 0 {
+			cf.Timeout = connectTimeout(conf)
+		}
+		base = &cf
+	}
+
+	f := &connFactory{
+		ConnectionFactory:  base,
+		auth:               newAuthInfo(conf),
+		writeTimeout:       conf.WriteTimeout,
+		readTimeout:        conf.ReadTimeout,
+		writeBufferSize:    conf.WriteBufferSize,
+		writeFlushInterval: conf.WriteFlushInterval,
+	}
+	if f.writeFlushInterval <= 0 {
+		f.writeFlushInterval = defaultWriteFlushInterval
+	}
+	return f
+}
+
+// connectTimeout returns the timeout of the dial and the TLS handshake.
+func connectTimeout(conf Config) time.Duration {
+	if conf.ConnectTimeout > 0 {
+		return conf.ConnectTimeout
+	}
+	return conf.Timeout
+}
+
+// dialFuncFactory dials with Config.DialFunc, and performs the TLS handshake if enabled.
+type dialFuncFactory struct {
+	dial      func(ctx context.Context, network, address string) (net.Conn, error)
+	network   string
+	address   string
+	tlsConfig *tls.Config
+	timeout   time.Duration // deadline of the dial and the TLS handshake (0 is no timeout)
+}
+
+func (f *dialFuncFactory) New() (net.Conn, error) {
+	ctx := context.Background()
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+
+	conn, err := f.dial(ctx, f.network, f.address)
+	if err != nil || f.tlsConfig == nil {
+		return conn, err
+	}
+	tc := tls.Client(conn, f.tlsConfig)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+// tlsConfig returns the TLS config for the connection, or nil when TLS is disabled.
+func tlsConfig(conf Config) *tls.Config {
+	var c *tls.Config
+	switch {
+	case conf.TLS != nil:
+		c = conf.TLS.Clone()
+	case conf.TLSEnabled:
+		c = &tls.Config{}
+	default:
+		return nil
+	}
+	if c.ServerName == "" {
+		c.ServerName = conf.Host
+	}
+	return c
+}
+
+// loadTLSConfig returns Config.TLS with the files and the options of the config,
+// or Config.TLS as it is when none of them is set.
+func loadTLSConfig(conf Config) (*tls.Config, error) {
+	if conf.TLSCAFile == "" && conf.TLSCertFile == "" && conf.TLSKeyFile == "" &&
+		!conf.TLSInsecureSkipVerify && conf.TLSServerName == "" {
+		return conf.TLS, nil
+	}
+
+	c := &tls.Config{}
+	if conf.TLS != nil {
+		c = conf.TLS.Clone()
+	}
+	if conf.TLSCAFile != "" {
+		b, err := os.ReadFile(conf.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("logrus_fluent: no certificate in %s", conf.TLSCAFile)
+		}
+		c.RootCAs = pool
+	}
+	if conf.TLSCertFile != "" || conf.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.TLSCertFile, conf.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	if conf.TLSInsecureSkipVerify {
+		c.InsecureSkipVerify = true
+	}
+	if conf.TLSServerName != "" {
+		c.ServerName = conf.TLSServerName
+	}
+	return c, nil
+}
+
+// New creates a new connection.
+func (f *connFactory) New() (net.Conn, error) {
+	conn, err := f.ConnectionFactory.New()
+	if err != nil {
+		return nil, err
+	}
+	if f.auth != nil {
+		if err := f.auth.handshake(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if f.writeTimeout > 0 || f.readTimeout > 0 {
+		conn = &deadlineConn{Conn: conn, writeTimeout: f.writeTimeout, readTimeout: f.readTimeout}
+	}
+	if f.writeBufferSize <= 0 {
+		return conn, nil
+	}
+
+	bc := newBufferedConn(conn, f.writeBufferSize, f.writeFlushInterval)
+	f.mu.Lock()
+	f.conn = bc
+	f.mu.Unlock()
+	return bc, nil
+}
+
+// Flush writes the buffered data of the latest connection.
+func (f *connFactory) Flush() error {
+	f.mu.Lock()
+	conn := f.conn
+	f.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.Flush()
+}
+
+// deadlineConn sets the deadline before every write and read,
+// so the write into the stuck connection, or the read of the ack which never comes, returns the timeout error.
+type deadlineConn struct {
+	net.Conn
+	writeTimeout time.Duration // 0 is no deadline
+	readTimeout  time.Duration // 0 keeps the deadline set by the client
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if c.writeTimeout > 0 {
+		if err := c.Conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	if c.readTimeout > 0 {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.readTimeout)); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Read(b)
+}
+
+// bufferedConn coalesces the small writes into the buffer,
+// and it's flushed when the buffer is full, on the interval, or before Read and Close.
+type bufferedConn struct {
+	net.Conn
+
+	mu  sync.Mutex
+	w   *bufio.Writer
+	err error // the error of the background flush, returned by the following writes and flushes.
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newBufferedConn(conn net.Conn, size int, interval time.Duration) *bufferedConn {
+	c := &bufferedConn{
+		Conn: conn,
+		w:    bufio.NewWriterSize(conn, size),
+		done: make(chan struct{}),
+	}
+	go c.flushLoop(interval)
+	return c
+}
+
+func (c *bufferedConn) flushLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// the broken connection isn't flushed anymore, and the next send fails to retry.
+			if c.Flush() != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Write writes the data into the buffer, or returns the error of the last flush.
+func (c *bufferedConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.w.Write(b)
+}
+
+// Read flushes the buffer before reading, as the response (e.g. ack) waits for the written data.
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	if err := c.Flush(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// Flush writes the buffered data into the connection.
+// The error is kept, so the send after the failed background flush fails too.
+func (c *bufferedConn) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = c.w.Flush()
+	}
+	return c.err
+}
+
+// Close flushes the buffer and closes the connection.
+func (c *bufferedConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.Flush()
+	})
+	if cerr := c.Conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// errConnClosed is returned when the connection closed by Close is used.
+var errConnClosed = errors.New("logrus_fluent: connection is closed")
+
+// pooledClient is the persistent logger in the connection pool.
+type pooledClient struct {
+	client *client.Client
+	lazy   *lazyClient // set when the connection is deferred until the first use.
+
+	// mu serializes the sends, as the message must be written into the connection at once.
+	mu sync.Mutex
+
+	// closeMu guards closed. It's not mu, so the connection of the stuck send can be closed.
+	closeMu sync.Mutex
+	closed  bool
+}
+
+// reconnect re-establishes the connection unless it's closed.
+func (p *pooledClient) reconnect() error {
+	p.closeMu.Lock()
+	defer p.closeMu.Unlock()
+	if p.closed {
+		return errConnClosed
+	}
+	return reconnectClient(p.client)
+}
+
+// close disconnects the logger, which is never reconnected after that.
+func (p *pooledClient) close() error {
+	if p.lazy != nil {
+		return p.lazy.close()
+	}
+	p.closeMu.Lock()
+	defer p.closeMu.Unlock()
+	p.closed = true
+	return p.client.Disconnect()
+}
+
+// newPool creates the persistent loggers of Config.PoolSize,
+// and connects them unless LazyConnect is set.
+func newPool(conf Config) ([]*pooledClient, error) {
+	size := conf.PoolSize
+	if size < 1 {
+		size = 1
+	}
+
+	pool := make([]*pooledClient, size)
+	for i := range pool {
+		c := newClient(conf)
+		p := &pooledClient{client: c}
+		if conf.LazyConnect {
+			p.lazy = &lazyClient{client: c}
+		} else if err := connectClient(c); err != nil {
+			for _, p := range pool[:i] {
+				p.client.Disconnect()
+			}
+			return nil, err
+		}
+		pool[i] = p
+	}
+	return pool, nil
+}
+
+// lazyClient establishes the shared connection on the first use.
+// When the connection is broken, only one goroutine reconnects it and others wait for it.
+type lazyClient struct {
+	client *client.Client
+
+	mu        sync.RWMutex
+	connected bool
+	closed    bool
+	gen       uint64 // generation of the connection
+}
+
+// get returns the connected client and the generation of the connection.
+func (l *lazyClient) get() (*client.Client, uint64, error) {
+	l.mu.RLock()
+	if l.connected {
+		defer l.mu.RUnlock()
+		return l.client, l.gen, nil
+	}
+	l.mu.RUnlock()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, 0, errConnClosed
+	}
+	if !l.connected {
+		if err := connectClient(l.client); err != nil {
+			return nil, 0, err
+		}
+		l.connected = true
+		l.gen++
+	}
+	return l.client, l.gen, nil
+}
+
+// reset disconnects the broken connection, and the next get reconnects.
+// It does nothing when the connection of the generation is already replaced.
+func (l *lazyClient) reset(gen uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.connected || l.gen != gen {
+		return
+	}
+	l.client.Disconnect()
+	l.connected = false
+}
+
+// close disconnects the connection, and get fails after that.
+func (l *lazyClient) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	l.connected = false
+	return l.client.Disconnect()
+}
@@ -0,0 +1,736 @@
+package logrus_fluent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/fluent-forward-go/fluent/client"
+	"github.com/IBM/fluent-forward-go/fluent/protocol"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tinylib/msgp/msgp"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
+)
+
+func TestBufferedConnFlush(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:               testHOST,
+		Port:               port,
+		WriteBufferSize:    4096,
+		WriteFlushInterval: time.Hour,
+	})
+	a.NoError(err)
+
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	select {
+	case <-messages:
+		t.Fatalf("message should be buffered")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	a.NoError(flushClient(hook.Fluent))
+	msg := receiveMessage(t, messages)
+	a.Equal(entryMessage, msg.Tag)
+
+	// flush on close
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.NoError(hook.Fluent.Disconnect())
+	msg = receiveMessage(t, messages)
+	a.Equal(entryMessage, msg.Tag)
+}
+
+func TestBufferedConnFlushInterval(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:               testHOST,
+		Port:               port,
+		WriteBufferSize:    4096,
+		WriteFlushInterval: 10 * time.Millisecond,
+	})
+	a.NoError(err)
+	defer hook.Fluent.Disconnect()
+
+	for i := 0; i < defaultLoopCount; i++ {
+		a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	}
+	for i := 0; i < defaultLoopCount; i++ {
+		msg := receiveMessage(t, messages)
+		a.Equal(entryMessage, msg.Tag)
+	}
+}
+
+// failingConn fails every write.
+type failingConn struct {
+	net.Conn
+	err error
+}
+
+func (c *failingConn) Write(b []byte) (int, error) { return 0, c.err }
+func (c *failingConn) Close() error                { return nil }
+
+func TestBufferedConnFlushError(t *testing.T) {
+	a := assert.New(t)
+
+	errWrite := errors.New("write error")
+	c := newBufferedConn(&failingConn{err: errWrite}, 4096, time.Millisecond)
+	defer c.Close()
+
+	_, err := c.Write([]byte("message"))
+	a.NoError(err)
+	// the error of the background flush is returned by the next write.
+	a.Eventually(func() bool {
+		_, err := c.Write([]byte("message"))
+		return errors.Is(err, errWrite)
+	}, time.Second, time.Millisecond)
+	a.ErrorIs(c.Flush(), errWrite)
+}
+
+func TestLazyConnect(t *testing.T) {
+	a := assert.New(t)
+
+	// the hook can be created without fluentd.
+	hook, err := NewWithConfig(Config{
+		Host:        testHOST,
+		Port:        -1,
+		LazyConnect: true,
+	})
+	a.NoError(err)
+	a.Error(hook.Fire(newEntry(nil, entryMessage)))
+
+	port, accepted, messages := newCountingServer(t)
+	hook, err = NewWithConfig(Config{
+		Host:        testHOST,
+		Port:        port,
+		LazyConnect: true,
+	})
+	a.NoError(err)
+	a.EqualValues(0, atomic.LoadInt32(accepted))
+
+	const goroutines = 20
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < goroutines; i++ {
+		receiveMessage(t, messages)
+	}
+	a.EqualValues(1, atomic.LoadInt32(accepted), "connection should be shared")
+}
+
+func TestLazyClientReset(t *testing.T) {
+	a := assert.New(t)
+
+	port, accepted, _ := newCountingServer(t)
+	lazy := &lazyClient{client: newClient(Config{Host: testHOST, Port: port})}
+
+	_, gen, err := lazy.get()
+	a.NoError(err)
+	lazy.reset(gen)
+	_, newGen, err := lazy.get()
+	a.NoError(err)
+	a.NotEqual(gen, newGen)
+
+	// reset by the old generation is ignored.
+	lazy.reset(gen)
+	_, current, err := lazy.get()
+	a.NoError(err)
+	a.Equal(newGen, current)
+	a.Eventually(func() bool {
+		return atomic.LoadInt32(accepted) == 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+func BenchmarkFireLazyConnectParallel(b *testing.B) {
+	l, err := net.Listen("tcp", testHOST+":0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go discard(conn)
+		}
+	}()
+
+	hook, err := NewWithConfig(Config{
+		Host:        testHOST,
+		Port:        l.Addr().(*net.TCPAddr).Port,
+		LazyConnect: true,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		entry := newEntry(nil, entryMessage)
+		for pb.Next() {
+			if err := hook.Fire(entry); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func TestDisableConnectionPool(t *testing.T) {
+	a := assert.New(t)
+
+	// the connection is shared, unless a new one is dialed every send with DialPerSend.
+	for _, dialPerSend := range []bool{false, true} {
+		port, accepted, messages := newCountingServer(t)
+		hook, err := NewWithConfig(Config{
+			Host:                  testHOST,
+			Port:                  port,
+			DisableConnectionPool: true,
+			DialPerSend:           dialPerSend,
+		})
+		a.NoError(err)
+		a.EqualValues(0, atomic.LoadInt32(accepted))
+
+		for i := 0; i < 3; i++ {
+			a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+			receiveMessage(t, messages)
+		}
+		expected := int32(1)
+		if dialPerSend {
+			expected = 3
+		}
+		a.EqualValues(expected, atomic.LoadInt32(accepted), dialPerSend)
+		a.NoError(hook.Close())
+	}
+}
+
+func TestPoolSize(t *testing.T) {
+	a := assert.New(t)
+
+	port, accepted, messages := newCountingServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:                 testHOST,
+		Port:                 port,
+		PoolSize:             3,
+		MaxRetries:           1,
+		RetryInitialInterval: time.Millisecond,
+	})
+	a.NoError(err)
+	a.Len(hook.Clients(), 3)
+	a.Equal(hook.Fluent, hook.Clients()[0])
+	a.Eventually(func() bool { return atomic.LoadInt32(accepted) == 3 }, time.Second, time.Millisecond)
+
+	// only the broken connection is re-established.
+	a.NoError(hook.Clients()[1].Disconnect())
+	for i := 0; i < 6; i++ {
+		a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+		receiveMessage(t, messages)
+	}
+	a.Eventually(func() bool { return atomic.LoadInt32(accepted) == 4 }, time.Second, time.Millisecond)
+	a.NoError(hook.Close())
+}
+
+type dialFactory struct {
+	address string
+	dialed  int32
+}
+
+func (f *dialFactory) New() (net.Conn, error) {
+	atomic.AddInt32(&f.dialed, 1)
+	return net.Dial("tcp", f.address)
+}
+
+func TestDialFunc(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	var dialed []string
+	hook, err := NewWithConfig(Config{
+		Host:    testHOST,
+		Port:    port,
+		Timeout: time.Second,
+		DialFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			_, ok := ctx.Deadline()
+			a.True(ok)
+			dialed = append(dialed, network+" "+address)
+			return (&net.Dialer{KeepAlive: time.Minute}).DialContext(ctx, network, address)
+		},
+	})
+	a.NoError(err)
+	defer hook.Close()
+	a.Equal([]string{fmt.Sprintf("tcp %s:%d", testHOST, port)}, dialed)
+
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	receiveMessage(t, messages)
+
+	dialErr := errors.New("dial error")
+	_, err = NewWithConfig(Config{
+		Host: testHOST,
+		Port: port,
+		DialFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, dialErr
+		},
+	})
+	a.ErrorIs(err, dialErr)
+
+	// Timeout is the dial timeout of the default factory.
+	f := newConnFactory(Config{Host: testHOST, Port: port, Timeout: time.Second}, nil)
+	a.Equal(time.Second, f.ConnectionFactory.(*client.ConnFactory).Timeout)
+}
+
+func TestConnectionOptions(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	factory := &dialFactory{address: fmt.Sprintf("%s:%d", testHOST, port)}
+	hook, err := NewWithConfig(Config{
+		Host:              testHOST,
+		Port:              -1,
+		ConnectionOptions: &client.ConnectionOptions{Factory: factory},
+		AckTimeout:        time.Minute,
+	})
+	a.NoError(err)
+	a.EqualValues(1, atomic.LoadInt32(&factory.dialed))
+	a.Equal(time.Minute, hook.Fluent.Timeout)
+
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.Equal(entryMessage, receiveMessage(t, messages).Tag)
+
+	// the zero fields of *client.ConnFactory are filled.
+	base := &client.ConnFactory{Timeout: time.Second}
+	f := newConnFactory(Config{Host: testHOST, Port: port, TLSEnabled: true}, base)
+	cf := f.ConnectionFactory.(*client.ConnFactory)
+	a.Equal(fmt.Sprintf("%s:%d", testHOST, port), cf.Address)
+	a.Equal(time.Second, cf.Timeout)
+	a.NotNil(cf.TLSConfig)
+	a.Empty(base.Address)
+
+	c := newClient(Config{
+		AckTimeout:        time.Minute,
+		ConnectionOptions: &client.ConnectionOptions{RequireAck: true, ConnectionTimeout: time.Second},
+	})
+	a.True(c.RequireAck)
+	a.Equal(time.Second, c.Timeout)
+}
+
+// newCountingServer starts mock server which counts the accepted connections.
+func newCountingServer(t *testing.T) (int, *int32, chan receivedMessage) {
+	l, err := net.Listen("tcp", testHOST+":0")
+	if err != nil {
+		t.Fatalf("Error listening: %s", err.Error())
+	}
+	t.Cleanup(func() { l.Close() })
+
+	var accepted int32
+	messages := make(chan receivedMessage, 100)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			go decodeMessages(conn, messages)
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port, &accepted, messages
+}
+
+func discard(conn net.Conn) {
+	defer conn.Close()
+	b := make([]byte, 1<<12)
+	for {
+		if _, err := conn.Read(b); err != nil {
+			return
+		}
+	}
+}
+
+func TestTLS(t *testing.T) {
+	a := assert.New(t)
+
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	addr := server.Listener.Addr().(*net.TCPAddr)
+
+	// the certificate is not trusted.
+	_, err := NewWithConfig(Config{
+		Host:       addr.IP.String(),
+		Port:       addr.Port,
+		TLSEnabled: true,
+	})
+	a.Error(err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	hook, err := NewWithConfig(Config{
+		Host: addr.IP.String(),
+		Port: addr.Port,
+		TLS:  &tls.Config{RootCAs: roots},
+	})
+	a.NoError(err)
+	a.NoError(hook.Fluent.Disconnect())
+
+	// the handshake is performed on the connection of DialFunc.
+	var dialed bool
+	hook, err = NewWithConfig(Config{
+		Host: addr.IP.String(),
+		Port: addr.Port,
+		TLS:  &tls.Config{RootCAs: roots},
+		DialFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialed = true
+			return (&net.Dialer{}).DialContext(ctx, network, address)
+		},
+	})
+	a.NoError(err)
+	a.True(dialed)
+	a.NoError(hook.Fluent.Disconnect())
+
+	a.Nil(tlsConfig(Config{Host: testHOST}))
+	a.Equal(testHOST, tlsConfig(Config{Host: testHOST, TLSEnabled: true}).ServerName)
+	a.Equal("example.com", tlsConfig(Config{Host: testHOST, TLS: &tls.Config{ServerName: "example.com"}}).ServerName)
+}
+
+func TestTLSFiles(t *testing.T) {
+	a := assert.New(t)
+
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	addr := server.Listener.Addr().(*net.TCPAddr)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	a.NoError(os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+	hook, err := NewWithConfig(Config{
+		Host:          testHOST,
+		Port:          addr.Port,
+		TLSCAFile:     caFile,
+		TLSServerName: "example.com",
+	})
+	a.NoError(err)
+	a.NoError(hook.Close())
+
+	hook, err = NewWithConfig(Config{
+		Host:                  testHOST,
+		Port:                  addr.Port,
+		TLSInsecureSkipVerify: true,
+	})
+	a.NoError(err)
+	a.NoError(hook.Close())
+
+	// the client certificate.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NoError(err)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	a.NoError(err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	a.NoError(err)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	a.NoError(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	a.NoError(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	c, err := loadTLSConfig(Config{TLSCertFile: certFile, TLSKeyFile: keyFile, TLS: &tls.Config{MinVersion: tls.VersionTLS13}})
+	a.NoError(err)
+	a.Len(c.Certificates, 1)
+	a.EqualValues(tls.VersionTLS13, c.MinVersion)
+
+	c, err = loadTLSConfig(Config{})
+	a.NoError(err)
+	a.Nil(c)
+
+	_, err = loadTLSConfig(Config{TLSCAFile: keyFile})
+	a.Error(err)
+	_, err = NewWithConfig(Config{TLSCAFile: filepath.Join(dir, "missing.pem")})
+	a.Error(err)
+}
+
+func TestSocketPath(t *testing.T) {
+	a := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "fluent.sock")
+	l, err := net.Listen("unix", path)
+	a.NoError(err)
+	t.Cleanup(func() { l.Close() })
+	messages := make(chan receivedMessage, defaultLoopCount)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go decodeMessages(conn, messages)
+		}
+	}()
+
+	for _, conf := range []Config{
+		{SocketPath: path},
+		{FluentNetwork: "unix", FluentSocketPath: path},
+	} {
+		hook, err := NewWithConfig(conf)
+		a.NoError(err)
+		a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+		a.Equal(entryMessage, receiveMessage(t, messages).Tag)
+		a.NoError(hook.Close())
+	}
+
+	_, err = NewWithConfig(Config{SocketPath: path, Host: testHOST})
+	a.Error(err)
+	_, err = NewWithConfig(Config{})
+	a.Error(err)
+	a.NoError(validateTransport(Config{ConnectionOptions: &client.ConnectionOptions{Factory: &client.ConnFactory{}}}))
+	a.Empty(socketPath(Config{FluentNetwork: "tcp", FluentSocketPath: path}))
+}
+
+func TestWriteTimeout(t *testing.T) {
+	a := assert.New(t)
+
+	// the server accepts the connection but never reads it.
+	l, err := net.Listen("tcp", testHOST+":0")
+	a.NoError(err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	hook, err := NewWithConfig(Config{
+		Host:         testHOST,
+		Port:         l.Addr().(*net.TCPAddr).Port,
+		WriteTimeout: 100 * time.Millisecond,
+	})
+	a.NoError(err)
+
+	// the large record fills the socket buffers and blocks the write.
+	value := strings.Repeat("x", 1<<20)
+	for i := 0; i < 64; i++ {
+		err = hook.Fire(newEntry(logrus.Fields{"value": value}, entryMessage))
+		if err != nil {
+			break
+		}
+	}
+	var netErr net.Error
+	if a.ErrorAs(err, &netErr) {
+		a.True(netErr.Timeout())
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	a := assert.New(t)
+
+	// the server never answers the ack.
+	server, err := testutil.NewServer()
+	a.NoError(err)
+	defer server.Close()
+	server.SetAck(false)
+
+	hook, err := NewWithConfig(Config{
+		Host:        server.Host(),
+		Port:        server.Port(),
+		RequireAck:  true,
+		AckTimeout:  time.Hour,
+		ReadTimeout: 100 * time.Millisecond,
+	})
+	a.NoError(err)
+	defer hook.Close()
+
+	start := time.Now()
+	err = hook.Fire(newEntry(nil, entryMessage))
+	var netErr net.Error
+	if a.ErrorAs(err, &netErr) {
+		a.True(netErr.Timeout())
+	}
+	a.Less(time.Since(start), 10*time.Second)
+}
+
+func TestKeepAlive(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(time.Second, connectTimeout(Config{Timeout: time.Second}))
+	a.Equal(time.Minute, connectTimeout(Config{Timeout: time.Second, ConnectTimeout: time.Minute}))
+
+	server, err := testutil.NewServer()
+	a.NoError(err)
+	defer server.Close()
+
+	conf := Config{
+		Host:           server.Host(),
+		Port:           server.Port(),
+		KeepAlive:      time.Second,
+		ConnectTimeout: time.Second,
+	}
+	f, ok := newConnFactory(conf, nil).ConnectionFactory.(*dialFuncFactory)
+	if a.True(ok) {
+		a.Equal(time.Second, f.timeout)
+	}
+
+	hook, err := NewWithConfig(conf)
+	a.NoError(err)
+	defer hook.Close()
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	_, err = server.WaitEvents(1, time.Second)
+	a.NoError(err)
+}
+
+func TestSharedKey(t *testing.T) {
+	a := assert.New(t)
+
+	const sharedKey = "secret"
+	l, err := net.Listen("tcp", testHOST+":0")
+	a.NoError(err)
+	t.Cleanup(func() { l.Close() })
+
+	messages := make(chan receivedMessage, defaultLoopCount)
+	hostnames := make(chan string, defaultLoopCount)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				helo := protocol.NewHelo(&protocol.HeloOpts{Nonce: []byte("nonce")})
+				if err := msgp.Encode(conn, helo); err != nil {
+					conn.Close()
+					return
+				}
+				var ping protocol.Ping
+				if err := msgp.Decode(conn, &ping); err != nil {
+					conn.Close()
+					return
+				}
+				hostnames <- ping.ClientHostname
+				ok := protocol.ValidatePingDigest(&ping, []byte(sharedKey), helo.Options.Nonce) == nil
+				pong, _ := protocol.NewPong(ok, "", "server", []byte(sharedKey), helo, &ping)
+				msgp.Encode(conn, pong)
+				if !ok {
+					conn.Close()
+					return
+				}
+				decodeMessages(conn, messages)
+			}()
+		}
+	}()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	_, err = NewWithConfig(Config{
+		Host:      testHOST,
+		Port:      port,
+		SharedKey: "wrong",
+	})
+	a.Error(err)
+	<-hostnames
+
+	hook, err := NewWithConfig(Config{
+		Host:         testHOST,
+		Port:         port,
+		SharedKey:    sharedKey,
+		SelfHostname: "client",
+	})
+	a.NoError(err)
+	a.Equal("client", <-hostnames)
+
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.Equal(entryMessage, receiveMessage(t, messages).Tag)
+}
+
+func TestUserAuth(t *testing.T) {
+	a := assert.New(t)
+
+	const sharedKey = "secret"
+	l, err := net.Listen("tcp", testHOST+":0")
+	a.NoError(err)
+	t.Cleanup(func() { l.Close() })
+
+	messages := make(chan receivedMessage, defaultLoopCount)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				helo := protocol.NewHelo(&protocol.HeloOpts{Nonce: []byte("nonce"), Auth: []byte("salt")})
+				if err := msgp.Encode(conn, helo); err != nil {
+					conn.Close()
+					return
+				}
+				var ping protocol.Ping
+				if err := msgp.Decode(conn, &ping); err != nil {
+					conn.Close()
+					return
+				}
+				digest := sha512.Sum512([]byte("salt" + "user" + "password"))
+				ok := ping.Username == "user" && ping.Password == hex.EncodeToString(digest[:])
+				pong, _ := protocol.NewPong(ok, "invalid user", "server", []byte(sharedKey), helo, &ping)
+				msgp.Encode(conn, pong)
+				if !ok {
+					conn.Close()
+					return
+				}
+				decodeMessages(conn, messages)
+			}()
+		}
+	}()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	_, err = NewWithConfig(Config{
+		Host:      testHOST,
+		Port:      port,
+		SharedKey: sharedKey,
+		Username:  "user",
+		Password:  "wrong",
+	})
+	a.ErrorContains(err, "invalid user")
+
+	hook, err := NewWithConfig(Config{
+		Host:      testHOST,
+		Port:      port,
+		SharedKey: sharedKey,
+		Username:  "user",
+		Password:  "password",
+		Timeout:   time.Second,
+	})
+	a.NoError(err)
+	defer hook.Close()
+
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.Equal(entryMessage, receiveMessage(t, messages).Tag)
+}
@@ -0,0 +1,97 @@
+package logrus_fluent
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBufferFull is the error of the dead letter dropped as the async buffer is full.
+var ErrBufferFull = errors.New("logrus_fluent: async buffer is full")
+
+// DeadLetter is the record which is never sent, see Config.DeadLetterSize.
+type DeadLetter struct {
+	Tag    string
+	Time   time.Time
+	Record map[string]interface{}
+	Err    error // e.g. ErrBufferFull, ErrBreakerOpen or the error of the last send.
+}
+
+// deadLetters is the bounded queue of the dead letters, which drops the oldest one when it's full.
+type deadLetters struct {
+	mu      sync.Mutex
+	size    int
+	letters []DeadLetter
+}
+
+// newDeadLetters returns the queue, or nil when it's disabled.
+func newDeadLetters(size int) *deadLetters {
+	if size <= 0 {
+		return nil
+	}
+	return &deadLetters{size: size}
+}
+
+// push adds the dead letter. It does nothing on nil.
+func (q *deadLetters) push(d DeadLetter) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.letters) >= q.size {
+		q.letters = q.letters[1:]
+	}
+	q.letters = append(q.letters, d)
+}
+
+// drain removes and returns all of the dead letters.
+func (q *deadLetters) drain() []DeadLetter {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	letters := q.letters
+	q.letters = nil
+	return letters
+}
+
+// SetDropHandler sets the handler called with the record which is never sent,
+// e.g. dropped by the overflow of the async buffer or failed after the retries,
+// so the critical records can be persisted elsewhere. nil removes the handler.
+// It's called by the background worker in the async mode, and should return quickly.
+func (hook *FluentHook) SetDropHandler(fn func(tag string, record map[string]interface{})) {
+	if fn == nil {
+		hook.dropHandler.Store(nil)
+		return
+	}
+	hook.dropHandler.Store(&fn)
+}
+
+// DeadLetters removes and returns the records in the dead-letter queue, in the dropped order.
+// It returns nil unless Config.DeadLetterSize is set.
+func (hook *FluentHook) DeadLetters() []DeadLetter {
+	return hook.deadLetters.drain()
+}
+
+// deadLetter passes the event which is never sent to the drop handler and the dead-letter queue.
+func (hook *FluentHook) deadLetter(ev *event, err error) {
+	fn := hook.dropHandler.Load()
+	if fn == nil && hook.deadLetters == nil {
+		return
+	}
+	record, ok := ev.record.(map[string]interface{})
+	if !ok {
+		record = ev.data
+	}
+	if fn != nil {
+		(*fn)(ev.tag, record)
+	}
+	hook.deadLetters.push(DeadLetter{
+		Tag:    ev.tag,
+		Time:   ev.time,
+		Record: record,
+		Err:    err,
+	})
+}
@@ -0,0 +1,93 @@
+package logrus_fluent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
+)
+
+func TestDeadLetters(t *testing.T) {
+	a := assert.New(t)
+
+	q := newDeadLetters(2)
+	for _, tag := range []string{"a", "b", "c"} {
+		q.push(DeadLetter{Tag: tag})
+	}
+	a.Equal([]DeadLetter{{Tag: "b"}, {Tag: "c"}}, q.drain())
+	a.Empty(q.drain())
+
+	// nil is disabled.
+	q = newDeadLetters(0)
+	q.push(DeadLetter{Tag: "a"})
+	a.Nil(q.drain())
+}
+
+func TestDeadLetterOverflow(t *testing.T) {
+	a := assert.New(t)
+
+	hook := &FluentHook{
+		queue:       make(chan *event, 1),
+		conf:        Config{OverflowPolicy: OverflowDrop},
+		deadLetters: newDeadLetters(10),
+	}
+	var dropped []string
+	hook.SetDropHandler(func(tag string, record map[string]interface{}) {
+		dropped = append(dropped, tag)
+	})
+	record := map[string]interface{}{"value": fieldValue}
+	a.NoError(hook.enqueue(context.Background(), &event{tag: staticTag, record: record}))
+	a.NoError(hook.enqueue(context.Background(), &event{tag: fieldTag, record: record}))
+	a.Equal([]string{fieldTag}, dropped)
+
+	hook.conf.OverflowPolicy = OverflowDropOldest
+	a.NoError(hook.enqueue(context.Background(), &event{tag: entryMessage, record: record}))
+	a.Equal([]string{fieldTag, staticTag}, dropped)
+
+	letters := hook.DeadLetters()
+	if a.Len(letters, 2) {
+		a.Equal(fieldTag, letters[0].Tag)
+		a.Equal(record, letters[0].Record)
+		a.ErrorIs(letters[0].Err, ErrBufferFull)
+		a.Equal(staticTag, letters[1].Tag)
+	}
+}
+
+func TestDeadLetterSize(t *testing.T) {
+	a := assert.New(t)
+
+	sendErr := errors.New("send error")
+	sender := testutil.NewMockSender()
+	sender.SetError(sendErr)
+	hook, err := NewWithConfig(Config{
+		Sender:         sender,
+		DefaultTag:     staticTag,
+		DeadLetterSize: 10,
+	})
+	a.NoError(err)
+	var dropped []map[string]interface{}
+	hook.SetDropHandler(func(tag string, record map[string]interface{}) {
+		dropped = append(dropped, record)
+	})
+
+	a.Error(hook.Fire(newEntry(logrus.Fields{"value": fieldValue}, entryMessage)))
+	if a.Len(dropped, 1) {
+		a.Equal(fieldValue, dropped[0]["value"])
+	}
+	letters := hook.DeadLetters()
+	if a.Len(letters, 1) {
+		a.Equal(staticTag, letters[0].Tag)
+		a.Equal(fieldValue, letters[0].Record["value"])
+		a.ErrorIs(letters[0].Err, sendErr)
+	}
+
+	// the handler is removed.
+	hook.SetDropHandler(nil)
+	a.Error(hook.Fire(newEntry(nil, entryMessage)))
+	a.Len(dropped, 1)
+	a.Len(hook.DeadLetters(), 1)
+}
@@ -0,0 +1,132 @@
+package logrus_fluent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultDedupCountField is the field name of the number of the collapsed duplicates.
+const DefaultDedupCountField = "repeat_count"
+
+// deduper collapses the duplicate events by Config.DedupWindow.
+type deduper struct {
+	window  time.Duration
+	field   string
+	exclude []string
+
+	mu   sync.Mutex
+	seen map[string]*dedupEntry
+	now  func() time.Time
+}
+
+// dedupEntry is the window of the event, started by the first one.
+type dedupEntry struct {
+	start time.Time
+	count int    // number of the duplicates in the window.
+	last  *event // the last duplicate.
+}
+
+// newDeduper returns the deduper, or nil when the deduplication is disabled.
+func newDeduper(conf Config) *deduper {
+	if conf.DedupWindow <= 0 {
+		return nil
+	}
+	field := conf.DedupCountField
+	if field == "" {
+		field = DefaultDedupCountField
+	}
+	return &deduper{
+		window:  conf.DedupWindow,
+		field:   field,
+		exclude: hashExclude(conf),
+		seen:    make(map[string]*dedupEntry),
+		now:     time.Now,
+	}
+}
+
+// add reports whether the event is the duplicate in the window, which is not sent now.
+// The repeat of the closed window of the same event is returned to be sent before it.
+func (d *deduper) add(ev *event) (bool, *event) {
+	if d == nil || ev.level <= logrus.FatalLevel {
+		return false, nil
+	}
+	m, ok := ev.record.(map[string]interface{})
+	if !ok {
+		return false, nil
+	}
+	hash, err := contentHash(ev.tag, m, d.exclude)
+	if err != nil {
+		return false, nil
+	}
+	key := ev.level.String() + "\x00" + hash
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	e, ok := d.seen[key]
+	if ok && now.Sub(e.start) < d.window {
+		e.count++
+		e.last = ev
+		return true, nil
+	}
+	d.seen[key] = &dedupEntry{start: now}
+	if ok {
+		return false, d.repeat(e)
+	}
+	return false, nil
+}
+
+// expire removes the closed windows, or all with force, and returns the repeats of them.
+func (d *deduper) expire(force bool) []*event {
+	if d == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	var repeats []*event
+	for key, e := range d.seen {
+		if !force && now.Sub(e.start) < d.window {
+			continue
+		}
+		delete(d.seen, key)
+		if ev := d.repeat(e); ev != nil {
+			repeats = append(repeats, ev)
+		}
+	}
+	return repeats
+}
+
+// repeat returns the last duplicate of the window with the number of the duplicates,
+// or nil when there's no duplicate.
+func (d *deduper) repeat(e *dedupEntry) *event {
+	if e.count == 0 {
+		return nil
+	}
+	ev := *e.last
+	data := make(logrus.Fields, len(ev.data)+1)
+	for k, v := range ev.data {
+		data[k] = v
+	}
+	data[d.field] = e.count
+	ev.data = data
+	if m, ok := ev.record.(map[string]interface{}); ok {
+		record := make(map[string]interface{}, len(m)+1)
+		for k, v := range m {
+			record[k] = v
+		}
+		record[d.field] = e.count
+		ev.record = record
+	}
+	return &ev
+}
+
+// sendRepeats sends the repeats of the closed windows, or all with force.
+func (hook *FluentHook) sendRepeats(force bool) {
+	for _, ev := range hook.deduper.expire(force) {
+		hook.deliver(ev)
+	}
+}
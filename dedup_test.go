@@ -0,0 +1,131 @@
+package logrus_fluent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
+)
+
+func TestDeduper(t *testing.T) {
+	a := assert.New(t)
+
+	a.Nil(newDeduper(Config{}))
+
+	now := time.Now()
+	d := newDeduper(Config{DedupWindow: time.Minute})
+	d.now = func() time.Time { return now }
+	newEvent := func(level logrus.Level, value string) *event {
+		return &event{
+			tag:    staticTag,
+			level:  level,
+			data:   logrus.Fields{"value": value},
+			record: map[string]interface{}{"value": value, "time": now.String()},
+		}
+	}
+
+	dup, repeat := d.add(newEvent(logrus.ErrorLevel, "a"))
+	a.False(dup)
+	a.Nil(repeat)
+	now = now.Add(time.Second)
+	dup, _ = d.add(newEvent(logrus.ErrorLevel, "a"))
+	a.True(dup, "the volatile field is ignored")
+	dup, _ = d.add(newEvent(logrus.ErrorLevel, "a"))
+	a.True(dup)
+	dup, _ = d.add(newEvent(logrus.WarnLevel, "a"))
+	a.False(dup, "the level is different")
+	dup, _ = d.add(newEvent(logrus.ErrorLevel, "b"))
+	a.False(dup, "the field is different")
+	dup, _ = d.add(newEvent(logrus.FatalLevel, "a"))
+	a.False(dup)
+	dup, _ = d.add(newEvent(logrus.FatalLevel, "a"))
+	a.False(dup, "Fatal is never collapsed")
+
+	a.Empty(d.expire(false))
+	now = now.Add(time.Minute)
+	repeats := d.expire(false)
+	if a.Len(repeats, 1) {
+		a.Equal(2, repeats[0].record.(map[string]interface{})[DefaultDedupCountField])
+		a.Equal(2, repeats[0].data[DefaultDedupCountField])
+	}
+	a.Empty(d.seen)
+
+	// the new event after the window returns the repeat of the closed window.
+	d.add(newEvent(logrus.ErrorLevel, "a"))
+	d.add(newEvent(logrus.ErrorLevel, "a"))
+	now = now.Add(time.Minute)
+	dup, repeat = d.add(newEvent(logrus.ErrorLevel, "a"))
+	a.False(dup)
+	if a.NotNil(repeat) {
+		a.Equal(1, repeat.record.(map[string]interface{})[DefaultDedupCountField])
+	}
+	d.add(newEvent(logrus.ErrorLevel, "a"))
+	a.Len(d.expire(true), 1)
+}
+
+func TestDedupWindow(t *testing.T) {
+	a := assert.New(t)
+
+	sender := testutil.NewMockSender()
+	hook, err := NewWithConfig(Config{
+		Sender:          sender,
+		DefaultTag:      staticTag,
+		DedupWindow:     time.Hour,
+		DedupCountField: "repeated",
+	})
+	a.NoError(err)
+
+	for i := 0; i < 3; i++ {
+		a.NoError(hook.Fire(newEntry(logrus.Fields{"value": fieldValue}, entryMessage)))
+	}
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.Len(sender.Messages(), 2)
+	a.EqualValues(2, hook.Stats().Deduplicated)
+
+	// the repeat is sent on Close.
+	a.NoError(hook.Close())
+	messages := sender.Messages()
+	if a.Len(messages, 3) {
+		record := messages[2].Record.(map[string]interface{})
+		a.Equal(fieldValue, record["value"])
+		a.Equal(entryMessage, record[MessageField])
+		a.Equal(2, record["repeated"])
+	}
+}
+
+func TestDedupWindowAsync(t *testing.T) {
+	a := assert.New(t)
+
+	sender := &blockingSender{release: make(chan struct{})}
+	hook, err := NewWithConfig(Config{
+		Sender:          sender,
+		DefaultTag:      staticTag,
+		AsyncBufferSize: 10,
+		DedupWindow:     time.Hour,
+	})
+	a.NoError(err)
+	now := time.Now()
+	hook.deduper.now = func() time.Time { return now }
+
+	// the repeat is buffered, and Fire doesn't wait for the stuck worker.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2; i++ {
+			a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+		}
+		now = now.Add(time.Hour)
+		a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Fire is blocked by the repeat")
+	}
+	a.EqualValues(1, hook.Stats().Deduplicated)
+	close(sender.release)
+	a.NoError(hook.Close())
+}
@@ -0,0 +1,86 @@
+package logrus_fluent
+
+import (
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ECSTimestampField is the timestamp field name of Elastic Common Schema.
+	ECSTimestampField = "@timestamp"
+	// ECSHostNameField is the host name field name of Elastic Common Schema.
+	ECSHostNameField = "host.name"
+)
+
+// defaultECSFieldNames is the preset to rename the standard fields into Elastic Common Schema,
+// which is copied into every hook with Config.ECSFieldNames.
+// Dotted names are nested into objects. (e.g. "log.level" => {"log": {"level": ...}})
+// see: https://www.elastic.co/guide/en/ecs/current/ecs-field-reference.html
+var defaultECSFieldNames = map[string]string{
+	LevelField:      "log.level",
+	logrus.ErrorKey: "error.message",
+}
+
+// ecsFieldNames returns ECS field names merged with user defined names.
+func ecsFieldNames(names map[string]string) map[string]string {
+	result := make(map[string]string, len(defaultECSFieldNames)+len(names))
+	for k, v := range defaultECSFieldNames {
+		result[k] = v
+	}
+	for k, v := range names {
+		result[k] = v
+	}
+	return result
+}
+
+// setECSFields renames and nests the standard fields into Elastic Common Schema.
+func (hook *FluentHook) setECSFields(entry *logrus.Entry, data logrus.Fields) {
+	fields := make(logrus.Fields)
+	if _, ok := data[ECSTimestampField]; !ok {
+		fields[ECSTimestampField] = entry.Time.Format(time.RFC3339Nano)
+	}
+	if _, ok := data[ECSHostNameField]; !ok && hook.hostname != "" {
+		fields[ECSHostNameField] = hook.hostname
+	}
+
+	rename := func(from, to string) {
+		v, ok := data[from]
+		if !ok || from == to {
+			return
+		}
+		delete(data, from)
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		fields[to] = v
+	}
+	// ECS always uses "message" for the log message.
+	field := hook.messageFieldName()
+	if _, ok := hook.ecsFieldNames[field]; !ok {
+		rename(field, MessageField)
+	}
+	for from, to := range hook.ecsFieldNames {
+		rename(from, to)
+	}
+
+	for k, v := range fields {
+		setNestedField(data, k, v)
+	}
+}
+
+// setNestedField sets the value into the nested map by the dotted name.
+func setNestedField(data logrus.Fields, name string, value interface{}) {
+	keys := strings.Split(name, ".")
+	m := map[string]interface{}(data)
+	for _, k := range keys[:len(keys)-1] {
+		child, ok := m[k].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			m[k] = child
+		}
+		m = child
+	}
+	m[keys[len(keys)-1]] = value
+}
@@ -0,0 +1,55 @@
+package logrus_fluent
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetECSFields(t *testing.T) {
+	a := assert.New(t)
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	tests := []struct {
+		messageField string
+		names        map[string]string
+		data         logrus.Fields
+		expected     logrus.Fields
+	}{
+		{
+			MessageField, nil,
+			logrus.Fields{"level": "error", "message": "msg", "error": errors.New("the error"), "value": 1},
+			logrus.Fields{
+				"@timestamp": "2020-01-02T03:04:05.000000006Z",
+				"message":    "msg",
+				"value":      1,
+				"log":        map[string]interface{}{"level": "error"},
+				"error":      map[string]interface{}{"message": "the error"},
+				"host":       map[string]interface{}{"name": "myhost"},
+			},
+		},
+		{
+			"msg", map[string]string{"level": "severity"},
+			logrus.Fields{"level": "error", "msg": "msg", "@timestamp": "custom"},
+			logrus.Fields{
+				"@timestamp": "custom",
+				"message":    "msg",
+				"severity":   "error",
+				"host":       map[string]interface{}{"name": "myhost"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		hook := &FluentHook{
+			messageField:  tt.messageField,
+			hostname:      "myhost",
+			ecsFieldNames: ecsFieldNames(tt.names),
+		}
+		hook.setECSFields(&logrus.Entry{Time: now}, tt.data)
+		a.Equal(tt.expected, tt.data)
+	}
+}
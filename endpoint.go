@@ -0,0 +1,270 @@
+package logrus_fluent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// LoadBalancing is the way to choose the endpoint in Config.Hosts.
+type LoadBalancing int
+
+const (
+	// LoadBalancePrimary sends to the first healthy endpoint,
+	// and fails over to the next one when it becomes unhealthy.
+	LoadBalancePrimary LoadBalancing = iota
+	// LoadBalanceRoundRobin sends to the healthy endpoints in turn.
+	LoadBalanceRoundRobin
+)
+
+const defaultHealthCheckInterval = 10 * time.Second
+
+// endpoint is the fluentd aggregator and its persistent loggers.
+type endpoint struct {
+	conf Config          // Host and Port are the address of the endpoint.
+	pool []*pooledClient // empty with Config.DialPerSend.
+	next atomic.Uint64   // index of the next client in the pool.
+	down atomic.Bool     // skipped until the health check reconnects it.
+}
+
+// endpointConfigs returns the config of each address in Config.Hosts,
+// or the config as it is when Hosts isn't set.
+func endpointConfigs(conf Config) ([]Config, error) {
+	if len(conf.Hosts) == 0 {
+		return []Config{conf}, nil
+	}
+
+	confs := make([]Config, len(conf.Hosts))
+	for i, h := range conf.Hosts {
+		host, port, err := net.SplitHostPort(h)
+		if err != nil {
+			return nil, fmt.Errorf("logrus_fluent: invalid host %q: %w", h, err)
+		}
+		c := conf
+		c.Host = host
+		if c.Port, err = strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("logrus_fluent: invalid port of host %q: %w", h, err)
+		}
+		confs[i] = c
+	}
+	return confs, nil
+}
+
+// newEndpoints creates the endpoints and their connection pools.
+// With several endpoints, the unreachable one is marked down instead of failing,
+// unless none of them is reachable.
+func newEndpoints(conf Config) ([]*endpoint, error) {
+	confs, err := endpointConfigs(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make([]*endpoint, len(confs))
+	var errs []error
+	for i, c := range confs {
+		if conf.DisableConnectionPool {
+			// the shared connection is created on the first use, instead of every send.
+			c.LazyConnect = true
+		}
+		e := &endpoint{conf: c}
+		if !conf.DialPerSend {
+			e.pool, err = newPool(c)
+			if err != nil {
+				if len(confs) == 1 {
+					return nil, err
+				}
+				errs = append(errs, err)
+				// connected by the health check later.
+				c.LazyConnect = true
+				e.pool, _ = newPool(c)
+				e.down.Store(true)
+			}
+		}
+		endpoints[i] = e
+	}
+	if len(errs) == len(confs) {
+		for _, e := range endpoints {
+			e.disconnect()
+		}
+		return nil, errors.Join(errs...)
+	}
+	return endpoints, nil
+}
+
+// pick returns the next persistent logger in the pool by round-robin,
+// or nil with Config.DialPerSend.
+func (e *endpoint) pick() *pooledClient {
+	if len(e.pool) == 0 {
+		return nil
+	}
+	n := e.next.Add(1) - 1
+	return e.pool[n%uint64(len(e.pool))]
+}
+
+// check reconnects the persistent loggers of the endpoint,
+// or dials it once with Config.DialPerSend.
+func (e *endpoint) check() error {
+	if len(e.pool) == 0 {
+		c := newClient(e.conf)
+		if err := connectClient(c); err != nil {
+			return err
+		}
+		return c.Disconnect()
+	}
+
+	for _, p := range e.pool {
+		if p.lazy != nil {
+			if _, _, err := p.lazy.get(); err != nil {
+				return err
+			}
+			continue
+		}
+		p.mu.Lock()
+		err := p.reconnect()
+		p.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// probe dials the endpoint with a new logger, which doesn't disturb the persistent loggers.
+// The dial continues in the background when the context is done first.
+func (e *endpoint) probe(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		c := newClient(e.conf)
+		err := connectClient(c)
+		if err == nil {
+			err = c.Disconnect()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// disconnect closes the connections of the persistent loggers, which are never reconnected after that.
+func (e *endpoint) disconnect() error {
+	var err error
+	for _, p := range e.pool {
+		if cerr := p.close(); cerr != nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// pickEndpoint returns the endpoint to send by Config.LoadBalancing.
+// The unhealthy endpoints are skipped, and the first one is returned when all of them are down.
+func (hook *FluentHook) pickEndpoint(endpoints []*endpoint) *endpoint {
+	if len(endpoints) == 1 {
+		return endpoints[0]
+	}
+
+	var start uint64
+	if hook.conf.LoadBalancing == LoadBalanceRoundRobin {
+		start = hook.next.Add(1) - 1
+	}
+	for i := range endpoints {
+		e := endpoints[(start+uint64(i))%uint64(len(endpoints))]
+		if !e.down.Load() {
+			return e
+		}
+	}
+	return endpoints[0]
+}
+
+// markDown marks the failed endpoint unhealthy, and reports whether
+// the send can fail over to the other endpoint.
+func markDown(endpoints []*endpoint, e *endpoint) bool {
+	e.down.Store(true)
+	return len(endpoints) > 1
+}
+
+// needsHealthCheck reports whether the endpoints are checked in the background,
+// i.e. there are several endpoints or Config.HealthCheckInterval is set.
+func (hook *FluentHook) needsHealthCheck(interval time.Duration) bool {
+	return len(hook.endpoints) > 1 || (len(hook.endpoints) > 0 && interval > 0)
+}
+
+// startHealthCheck reconnects the unhealthy endpoints in the background.
+// With Config.HealthCheckInterval, the healthy endpoints are probed too,
+// and the unreachable one is marked down before the send fails.
+func (hook *FluentHook) startHealthCheck(interval time.Duration) {
+	probe := interval > 0
+	if !probe {
+		interval = defaultHealthCheckInterval
+	}
+	hook.healthCheck = startPeriodic(interval, func() {
+		// the endpoints are not swapped by Reload while they're checked.
+		hook.endpointMu.RLock()
+		defer hook.endpointMu.RUnlock()
+		for _, e := range hook.endpoints {
+			switch {
+			case e.down.Load():
+				if e.check() == nil {
+					e.down.Store(false)
+				}
+			case probe:
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				if e.probe(ctx) != nil {
+					e.down.Store(true)
+				}
+				cancel()
+			}
+		}
+	})
+}
+
+// Pinger is the FluentSender which can check its connection, used by Ping.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping verifies that fluentd is reachable by dialing every endpoint with a new connection,
+// e.g. for the readiness probe. It succeeds when any of the endpoints is reachable,
+// and the unreachable endpoints are marked down like the failed sends.
+// The sender set by Config.Sender or SetSender is checked only when it implements Pinger.
+func (hook *FluentHook) Ping(ctx context.Context) error {
+	if hook.isClosed() {
+		return ErrClosed
+	}
+
+	hook.senderMu.Lock()
+	sender := hook.sender
+	hook.senderMu.Unlock()
+	if sender != nil {
+		if p, ok := sender.(Pinger); ok {
+			return p.Ping(ctx)
+		}
+		return nil
+	}
+	endpoints, _ := hook.connections()
+	if len(endpoints) == 0 {
+		return errNoSender
+	}
+
+	var errs []error
+	for _, e := range endpoints {
+		if err := e.probe(ctx); err != nil {
+			e.down.Store(true)
+			errs = append(errs, err)
+			continue
+		}
+		e.down.Store(false)
+	}
+	if len(errs) == len(endpoints) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
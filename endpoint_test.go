@@ -0,0 +1,164 @@
+package logrus_fluent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
+)
+
+func TestEndpointConfigs(t *testing.T) {
+	a := assert.New(t)
+
+	confs, err := endpointConfigs(Config{Hosts: []string{"fluentd-1:24224", "[::1]:24225"}})
+	a.NoError(err)
+	if a.Len(confs, 2) {
+		a.Equal("fluentd-1", confs[0].Host)
+		a.Equal(24224, confs[0].Port)
+		a.Equal("::1", confs[1].Host)
+		a.Equal(24225, confs[1].Port)
+	}
+
+	_, err = endpointConfigs(Config{Hosts: []string{"fluentd-1"}})
+	a.Error(err)
+	_, err = endpointConfigs(Config{Hosts: []string{"fluentd-1:forward"}})
+	a.Error(err)
+
+	_, err = NewWithConfig(Config{Host: testHOST, Hosts: []string{"fluentd-1:24224"}})
+	a.Error(err)
+}
+
+func TestHostsFailover(t *testing.T) {
+	a := assert.New(t)
+
+	// the primary endpoint is unreachable at first.
+	l, err := net.Listen("tcp", testHOST+":0")
+	a.NoError(err)
+	primary := l.Addr().String()
+	l.Close()
+
+	port, messages := newMessageServer(t)
+	secondary := fmt.Sprintf("%s:%d", testHOST, port)
+
+	_, err = NewWithConfig(Config{Hosts: []string{primary, primary}})
+	a.Error(err)
+
+	hook, err := NewWithConfig(Config{
+		Hosts:               []string{primary, secondary},
+		HealthCheckInterval: 10 * time.Millisecond,
+	})
+	a.NoError(err)
+	defer hook.Close()
+	a.Len(hook.Clients(), 2)
+
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	receiveMessage(t, messages)
+
+	// the primary is used again after the health check reconnects it.
+	l, err = net.Listen("tcp", primary)
+	if err != nil {
+		t.Skipf("the port is reused: %s", err)
+	}
+	defer l.Close()
+	primaryMessages := make(chan receivedMessage, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			decodeMessages(conn, primaryMessages)
+		}
+	}()
+	a.Eventually(func() bool { return !hook.endpoints[0].down.Load() }, time.Second, time.Millisecond)
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	receiveMessage(t, primaryMessages)
+}
+
+func TestHostsRoundRobin(t *testing.T) {
+	a := assert.New(t)
+
+	port1, messages1 := newMessageServer(t)
+	port2, messages2 := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Hosts: []string{
+			fmt.Sprintf("%s:%d", testHOST, port1),
+			fmt.Sprintf("%s:%d", testHOST, port2),
+		},
+		LoadBalancing:         LoadBalanceRoundRobin,
+		DisableConnectionPool: true,
+	})
+	a.NoError(err)
+	defer hook.Close()
+
+	for i := 0; i < 2; i++ {
+		a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+		receiveMessage(t, messages1)
+		a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+		receiveMessage(t, messages2)
+	}
+}
+
+type pingSender struct {
+	testutil.MockSender
+	err error
+}
+
+func (s *pingSender) Ping(ctx context.Context) error { return s.err }
+
+func TestPing(t *testing.T) {
+	a := assert.New(t)
+
+	port, _ := newMessageServer(t)
+	l, err := net.Listen("tcp", testHOST+":0")
+	a.NoError(err)
+	down := l.Addr().String()
+	l.Close()
+
+	hook, err := NewWithConfig(Config{Host: testHOST, Port: port})
+	a.NoError(err)
+	a.NoError(hook.Ping(context.Background()))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a.ErrorIs(hook.Ping(ctx), context.Canceled)
+	a.NoError(hook.Close())
+	a.ErrorIs(hook.Ping(context.Background()), ErrClosed)
+
+	// it succeeds while any endpoint is reachable.
+	hook, err = NewWithConfig(Config{Hosts: []string{down, fmt.Sprintf("%s:%d", testHOST, port)}})
+	a.NoError(err)
+	defer hook.Close()
+	a.NoError(hook.Ping(context.Background()))
+	a.Equal(1, hook.Stats().EndpointsDown)
+
+	// the sender is checked only when it implements Pinger.
+	sender := &pingSender{err: errors.New("ping error")}
+	hook.SetSender(sender)
+	a.ErrorIs(hook.Ping(context.Background()), sender.err)
+	hook.SetSender(testutil.NewMockSender())
+	a.NoError(hook.Ping(context.Background()))
+}
+
+func TestHealthCheckProbe(t *testing.T) {
+	a := assert.New(t)
+
+	l, err := net.Listen("tcp", testHOST+":0")
+	a.NoError(err)
+	hook, err := NewWithConfig(Config{
+		Host:                testHOST,
+		Port:                l.Addr().(*net.TCPAddr).Port,
+		HealthCheckInterval: 10 * time.Millisecond,
+		LazyConnect:         true,
+	})
+	a.NoError(err)
+	defer hook.Close()
+	a.NotNil(hook.healthCheck)
+	a.Equal(0, hook.Stats().EndpointsDown)
+
+	// the endpoint is marked down before any send fails.
+	l.Close()
+	a.Eventually(func() bool { return hook.Stats().EndpointsDown == 1 }, time.Second, 10*time.Millisecond)
+}
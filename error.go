@@ -0,0 +1,162 @@
+package logrus_fluent
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// ErrorFormat is the format of error values in the log fields.
+type ErrorFormat int
+
+const (
+	// ErrorFormatDefault leaves error values to the converter.
+	ErrorFormatDefault ErrorFormat = iota
+	// ErrorFormatSentry converts error values into the exception shape of Sentry.
+	//
+	// {"type": "*errors.fundamental", "value": "message", "stacktrace": {"frames": [...]}}
+	ErrorFormatSentry
+	// ErrorFormatStack converts error values into the message string,
+	// and adds the stack trace into the field with ErrorStackSuffix when the error has it.
+	//
+	// {"error": "message", "error.stack": "function\n\tfile:line\n..."}
+	ErrorFormatStack
+)
+
+// ErrorStackSuffix is appended to the field name of the stack trace of ErrorFormatStack.
+const ErrorStackSuffix = ".stack"
+
+// formatError converts the error value by the format.
+func formatError(v interface{}, format ErrorFormat) interface{} {
+	err, ok := v.(error)
+	if !ok {
+		return v
+	}
+
+	switch format {
+	case ErrorFormatSentry:
+		return sentryException(err)
+	case ErrorFormatStack:
+		return err.Error()
+	default:
+		return v
+	}
+}
+
+// errorStack returns the stack trace of the error value for ErrorFormatStack,
+// in the same format as "%+v" of github.com/pkg/errors, or "" if it has no stack trace.
+func errorStack(v interface{}, format ErrorFormat) string {
+	err, ok := v.(error)
+	if !ok || format != ErrorFormatStack {
+		return ""
+	}
+
+	var b strings.Builder
+	for i, f := range stackFrames(err) {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "%s\n\t%s:%d", f.Function, f.File, f.Line)
+	}
+	return b.String()
+}
+
+// sentryException returns the exception interface of Sentry.
+// see: https://develop.sentry.dev/sdk/event-payloads/exception/
+func sentryException(err error) map[string]interface{} {
+	result := map[string]interface{}{
+		"type":  fmt.Sprintf("%T", err),
+		"value": err.Error(),
+	}
+
+	frames := stackFrames(err)
+	if len(frames) == 0 {
+		return result
+	}
+
+	// Sentry expects the frames from the oldest to the newest.
+	list := make([]interface{}, 0, len(frames))
+	for i := len(frames) - 1; i >= 0; i-- {
+		f := frames[i]
+		list = append(list, map[string]interface{}{
+			"function": f.Function,
+			"filename": f.File,
+			"lineno":   f.Line,
+		})
+	}
+	result["stacktrace"] = map[string]interface{}{
+		"frames": list,
+	}
+	return result
+}
+
+// stackFrames returns the stack trace of the innermost error which has it.
+// The error is compatible with `StackTrace()` of github.com/pkg/errors,
+// which returns the slice of program counters.
+func stackFrames(err error) []runtime.Frame {
+	var pcs []uintptr
+	for err != nil {
+		if list := stackTrace(err); len(list) != 0 {
+			pcs = list
+		}
+		err = unwrapError(err)
+	}
+	if len(pcs) == 0 {
+		return nil
+	}
+
+	var result []runtime.Frame
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		result = append(result, f)
+		if !more {
+			break
+		}
+	}
+	return result
+}
+
+// stackTrace calls `StackTrace()` of the error and returns program counters.
+// The typed nil pointer is skipped, since the method may dereference it.
+func stackTrace(err error) []uintptr {
+	v := reflect.ValueOf(err)
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+	method := v.MethodByName("StackTrace")
+	if !method.IsValid() {
+		return nil
+	}
+
+	mt := method.Type()
+	if mt.NumIn() != 0 || mt.NumOut() != 1 {
+		return nil
+	}
+	out := mt.Out(0)
+	if out.Kind() != reflect.Slice || out.Elem().Kind() != reflect.Uintptr {
+		return nil
+	}
+
+	rv := method.Call(nil)[0]
+	pcs := make([]uintptr, rv.Len())
+	for i := range pcs {
+		pcs[i] = uintptr(rv.Index(i).Uint())
+	}
+	return pcs
+}
+
+// unwrapError returns the wrapped error by `Unwrap()` or `Cause()`.
+func unwrapError(err error) error {
+	if e := errors.Unwrap(err); e != nil {
+		return e
+	}
+	if c, ok := err.(interface{ Cause() error }); ok {
+		if e := c.Cause(); e != err {
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package logrus_fluent
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// frame and stackError are the same shapes as github.com/pkg/errors.
+type frame uintptr
+
+type stackError struct {
+	msg   string
+	stack []uintptr
+}
+
+func newStackError(msg string) error {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	return &stackError{msg: msg, stack: pcs[:n]}
+}
+
+func (e *stackError) Error() string { return e.msg }
+
+func (e *stackError) StackTrace() []frame {
+	list := make([]frame, len(e.stack))
+	for i, pc := range e.stack {
+		list[i] = frame(pc)
+	}
+	return list
+}
+
+func TestFormatErrorSentry(t *testing.T) {
+	a := assert.New(t)
+
+	err := fmt.Errorf("wrapped: %w", newStackError("the error"))
+	result, ok := formatError(err, ErrorFormatSentry).(map[string]interface{})
+	a.True(ok)
+	a.Equal("*fmt.wrapError", result["type"])
+	a.Equal("wrapped: the error", result["value"])
+
+	stacktrace, ok := result["stacktrace"].(map[string]interface{})
+	a.True(ok)
+	frames, ok := stacktrace["frames"].([]interface{})
+	a.True(ok)
+	a.NotEmpty(frames)
+
+	// the newest frame is the last one.
+	last, ok := frames[len(frames)-1].(map[string]interface{})
+	a.True(ok)
+	a.Equal("github.com/jmaitrehenry/logrus_fluent.TestFormatErrorSentry", last["function"])
+	a.Contains(last["filename"], "error_test.go")
+	a.NotZero(last["lineno"])
+}
+
+func TestFormatErrorSentryPkgErrors(t *testing.T) {
+	a := assert.New(t)
+
+	err := pkgerrors.Wrap(pkgerrors.New("the error"), "wrapped")
+	result, ok := formatError(err, ErrorFormatSentry).(map[string]interface{})
+	a.True(ok)
+	a.Equal("*errors.withStack", result["type"])
+	a.Equal("wrapped: the error", result["value"])
+
+	stacktrace, ok := result["stacktrace"].(map[string]interface{})
+	a.True(ok)
+	frames, ok := stacktrace["frames"].([]interface{})
+	a.True(ok)
+	a.NotEmpty(frames)
+	for _, f := range frames {
+		frame, ok := f.(map[string]interface{})
+		if a.True(ok) {
+			a.Len(frame, 3)
+			a.IsType("", frame["function"])
+			a.IsType("", frame["filename"])
+			a.IsType(0, frame["lineno"])
+		}
+	}
+
+	// the frames are of the innermost stack, which is taken by errors.New.
+	last := frames[len(frames)-1].(map[string]interface{})
+	a.Equal("github.com/jmaitrehenry/logrus_fluent.TestFormatErrorSentryPkgErrors", last["function"])
+	a.Contains(last["filename"], "error_test.go")
+	a.NotZero(last["lineno"])
+}
+
+func TestFormatErrorSentryWithoutStack(t *testing.T) {
+	a := assert.New(t)
+
+	result := formatError(errors.New("the error"), ErrorFormatSentry)
+	a.Equal(map[string]interface{}{
+		"type":  "*errors.errorString",
+		"value": "the error",
+	}, result)
+}
+
+func TestFormatErrorDefault(t *testing.T) {
+	a := assert.New(t)
+
+	err := errors.New("the error")
+	a.Equal(err, formatError(err, ErrorFormatDefault))
+	a.Equal("value", formatError("value", ErrorFormatSentry))
+}
+
+func TestFormatErrorStack(t *testing.T) {
+	a := assert.New(t)
+
+	err := fmt.Errorf("wrapped: %w", newStackError("the error"))
+	a.Equal("wrapped: the error", formatError(err, ErrorFormatStack))
+
+	stack := errorStack(err, ErrorFormatStack)
+	a.True(strings.HasPrefix(stack, "github.com/jmaitrehenry/logrus_fluent.TestFormatErrorStack\n\t"), stack)
+	a.Contains(stack, "error_test.go:")
+
+	a.Empty(errorStack(errors.New("the error"), ErrorFormatStack))
+	a.Empty(errorStack(err, ErrorFormatDefault))
+	a.Empty(errorStack("value", ErrorFormatStack))
+
+	// the typed nil pointer doesn't panic.
+	a.Nil(stackTrace((*stackError)(nil)))
+	a.Nil(stackFrames(fmt.Errorf("wrapped: %w", (*stackError)(nil))))
+
+	port, messages := newMessageServer(t)
+	hook, herr := NewWithConfig(Config{
+		Host:        testHOST,
+		Port:        port,
+		ErrorFormat: ErrorFormatStack,
+	})
+	a.NoError(herr)
+	a.NoError(hook.Fire(newEntry(logrus.Fields{logrus.ErrorKey: err}, entryMessage)))
+	msg := receiveMessage(t, messages)
+	a.Equal("wrapped: the error", msg.Record[logrus.ErrorKey])
+	a.Equal(stack, msg.Record[logrus.ErrorKey+ErrorStackSuffix])
+}
@@ -0,0 +1,56 @@
+package logrus_fluent
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fallbackRecord is JSON format written into the fallback writer.
+type fallbackRecord struct {
+	Tag    string      `json:"tag"`
+	Time   time.Time   `json:"time"`
+	Record interface{} `json:"record"`
+	Error  string      `json:"error,omitempty"` // set with Config.FallbackMarkError
+}
+
+// writeFallback writes the record into the fallback writer as a JSON line,
+// when the send was failed for the level in Config.FallbackLevels.
+func (hook *FluentHook) writeFallback(level logrus.Level, tag string, t time.Time, record interface{}, cause error) error {
+	if hook.conf.Fallback == nil || !hook.isFallbackLevel(level) {
+		return nil
+	}
+
+	r := fallbackRecord{
+		Tag:    tag,
+		Time:   t,
+		Record: record,
+	}
+	if hook.conf.FallbackMarkError && cause != nil {
+		r.Error = cause.Error()
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	hook.fallbackMu.Lock()
+	defer hook.fallbackMu.Unlock()
+	_, err = hook.conf.Fallback.Write(append(b, '\n'))
+	return err
+}
+
+// isFallbackLevel checks the entry of the level is written into the fallback writer or not.
+// All of the levels are written when Config.FallbackLevels is empty.
+func (hook *FluentHook) isFallbackLevel(level logrus.Level) bool {
+	if len(hook.conf.FallbackLevels) == 0 {
+		return true
+	}
+	for _, l := range hook.conf.FallbackLevels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
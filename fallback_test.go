@@ -0,0 +1,59 @@
+package logrus_fluent
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFallback(t *testing.T) {
+	a := assert.New(t)
+
+	var buf bytes.Buffer
+	hook := NewHook(testHOST, -1)
+	hook.conf.Fallback = &buf
+	hook.conf.FallbackLevels = []logrus.Level{logrus.ErrorLevel}
+
+	// no fluentd is listening on the port.
+	entry := newEntry(logrus.Fields{"value": fieldValue}, entryMessage)
+	a.Error(hook.Fire(entry))
+
+	var result map[string]interface{}
+	a.NoError(json.Unmarshal(buf.Bytes(), &result))
+	a.Equal(entryMessage, result["tag"])
+	a.Equal(map[string]interface{}{
+		"level":   "error",
+		"message": entryMessage,
+		"value":   fieldValue,
+	}, result["record"])
+
+	a.NotContains(result, "error")
+
+	buf.Reset()
+	hook.conf.FallbackMarkError = true
+	a.Error(hook.Fire(entry))
+	result = nil
+	a.NoError(json.Unmarshal(buf.Bytes(), &result))
+	a.NotEmpty(result["error"])
+
+	// the level is not in FallbackLevels.
+	buf.Reset()
+	entry.Level = logrus.InfoLevel
+	a.Error(hook.Fire(entry))
+	a.Zero(buf.Len())
+}
+
+func TestIsFallbackLevel(t *testing.T) {
+	a := assert.New(t)
+
+	hook := &FluentHook{}
+	a.True(hook.isFallbackLevel(logrus.InfoLevel))
+
+	hook.conf.FallbackLevels = []logrus.Level{logrus.ErrorLevel, logrus.FatalLevel}
+	a.True(hook.isFallbackLevel(logrus.ErrorLevel))
+	a.True(hook.isFallbackLevel(logrus.FatalLevel))
+	a.False(hook.isFallbackLevel(logrus.InfoLevel))
+}
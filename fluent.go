@@ -1,7 +1,14 @@
 package logrus_fluent
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/IBM/fluent-forward-go/fluent/client"
 	"github.com/sirupsen/logrus"
 )
@@ -14,6 +21,8 @@ const (
 	//     Value1: `fluent:"value_1"`    // change field name.
 	//     Value2: `fluent:"-"`          // always omit this field.
 	//     Value3: `fluent:",omitempty"` // omit this field when zero-value.
+	//     Value4: `fluent:",mask"`      // replace the value with MaskValue.
+	//     Value5: `fluent:"ssn,mask,omitempty"`
 	// }
 	TagName = "fluent"
 	// TagField is logrus field name used as fluentd tag
@@ -21,6 +30,17 @@ const (
 	// MessageField is logrus field name used as message.
 	// If missing in the log fields, entry.Message is set to this field.
 	MessageField = "message"
+	// LevelField is the default field name of the log level.
+	LevelField = "level"
+	// MaskValue is used instead of the actual value for the field with mask option.
+	MaskValue = "***"
+)
+
+// Config.TimestampFormat for the epoch time as a number instead of the time layout.
+const (
+	TimestampEpochSeconds = "epoch"
+	TimestampEpochMillis  = "epoch_millis"
+	TimestampEpochNanos   = "epoch_nanos"
 )
 
 var defaultLevels = []logrus.Level{
@@ -31,21 +51,82 @@ var defaultLevels = []logrus.Level{
 	logrus.InfoLevel,
 }
 
+var defaultSyncLevels = []logrus.Level{
+	logrus.PanicLevel,
+	logrus.FatalLevel,
+}
+
 // FluentHook is logrus hook for fluentd.
 type FluentHook struct {
-	// Fluent is actual fluentd logger.
-	// If set, this logger is used for logging.
+	// Fluent is actual fluentd logger, the first one in the connection pool.
+	// If set, the loggers in the pool are used for logging.
 	// otherwise new logger is created every time.
-	Fluent *client.Client
-	conf   Config
-
-	levels []logrus.Level
-	tag    *string
-
+	Fluent    *client.Client
+	conf      Config
+	pool      []*pooledClient // the loggers of all endpoints, Fluent is the first one.
+	endpoints []*endpoint
+	next      atomic.Uint64 // index of the next endpoint for LoadBalanceRoundRobin.
+
+	healthCheck *periodic
+
+	// endpointMu guards Fluent, pool, endpoints and healthCheck, which are swapped by Reload.
+	// The sends read them under the read lock, and the old connections are closed without waiting for the sends on them.
+	endpointMu sync.RWMutex
+	reloadMu   sync.Mutex // serializes Reload.
+
+	sendTimeout atomic.Int64 // Config.SendTimeout, changed by Reload.
+
+	senderMu sync.Mutex
+	sender   FluentSender // used instead of the connections if set.
+
+	errorHandler atomic.Pointer[func(entry *logrus.Entry, err error)]
+	dropHandler  atomic.Pointer[func(tag string, record map[string]interface{})]
+	deadLetters  *deadLetters
+
+	buffer *diskBuffer // persistent queue of the async mode, see Config.BufferPath.
+
+	breaker       *breaker
+	sampler       *sampler
+	suppressed    atomic.Uint64 // number of the entries dropped since the last summary.
+	sampleSummary *periodic
+	deduper       *deduper
+	dedupFlush    *periodic
+
+	syncLevels      map[logrus.Level]struct{}
+	tagTemplate     tagTemplate
+	messageTemplate tagTemplate // Config.MessageTemplate
+
+	// confMu guards the fields below, which are changed by the setters at runtime.
+	confMu       sync.RWMutex
+	levels       []logrus.Level
+	tag          *string
+	tagPrefix    string
 	messageField string
-	ignoreFields map[string]struct{}
-	filters      map[string]func(interface{}) interface{}
-	customizers  []func(entry *logrus.Entry, data logrus.Fields)
+
+	// filterMu guards the fields below, which are read while Fire builds the record.
+	filterMu      sync.RWMutex
+	ignoreFields  map[string]struct{}
+	allowFields   map[string]struct{} // nil allows all fields.
+	filters       map[string]func(interface{}) interface{}
+	globalFilters []func(key string, value interface{}) interface{}
+	keyFilters    []func(key string, value interface{}) (string, interface{}, bool)
+	customizers   []func(entry *logrus.Entry, data logrus.Fields) bool // the customizers and the interceptors in the added order.
+
+	staticFields  logrus.Fields
+	hostname      string
+	ecsFieldNames map[string]string
+
+	fallbackMu sync.Mutex
+	mirrorMu   sync.Mutex
+	stats      stats
+
+	queue   chan *event
+	done    chan struct{}
+	closeMu sync.RWMutex
+	closed  bool
+
+	// inflight counts the deliveries continued in the background by deliverContext, which Close waits for.
+	inflight sync.WaitGroup
 }
 
 // New returns initialized logrus hook for fluentd with persistent fluentd logger.
@@ -59,45 +140,122 @@ func New(host string, port int) (*FluentHook, error) {
 
 // NewWithConfig returns initialized logrus hook by config setting.
 func NewWithConfig(conf Config) (*FluentHook, error) {
-	var fd *client.Client
-	if !conf.DisableConnectionPool {
-		fd = client.New(client.ConnectionOptions{
-			Factory: &client.ConnFactory{
-				Address: fmt.Sprintf("%s:%d", conf.Host, conf.Port),
-			},
-		})
-		err := fd.Connect()
-		if err != nil {
+	var buffer *diskBuffer
+	var replay []*event
+	if conf.BufferPath != "" && asyncBufferSize(conf) > 0 {
+		var err error
+		if buffer, err = newDiskBuffer(conf.BufferPath); err != nil {
+			return nil, err
+		}
+		if replay, err = buffer.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	switch conf.Transport {
+	case "", TransportTCP:
+	case TransportWebSocket:
+		if conf.Sender == nil {
+			sender, err := newWSSender(conf)
+			if err != nil {
+				return nil, err
+			}
+			conf.Sender = sender
+		}
+	default:
+		return nil, fmt.Errorf("logrus_fluent: unknown transport %q", conf.Transport)
+	}
+
+	var endpoints []*endpoint
+	if conf.Sender != nil {
+		if err := conf.Sender.Connect(); err != nil {
 			return nil, err
 		}
+	} else {
+		var err error
+		if endpoints, err = connectEndpoints(conf); err != nil {
+			return nil, err
+		}
+	}
+	if err := connectMirrors(conf.MirrorSenders); err != nil {
+		if conf.Sender != nil {
+			conf.Sender.Disconnect()
+		}
+		for _, e := range endpoints {
+			e.disconnect()
+		}
+		return nil, err
+	}
+
+	fd, pool := poolOf(endpoints)
+
+	if conf.TraceContextFunc != nil {
+		// copy not to append into the slice of the caller
+		extractors := make([]func(context.Context) logrus.Fields, 0, len(conf.ContextExtractors)+1)
+		extractors = append(extractors, conf.ContextExtractors...)
+		conf.ContextExtractors = append(extractors, traceContextExtractor(conf.TraceContextFunc, conf.TraceIDField, conf.SpanIDField))
+	}
+
+	if conf.CompressPayload {
+		conf.BatchMode = BatchCompressedPackedForward
 	}
 
 	hook := &FluentHook{
 		Fluent:       fd,
 		conf:         conf,
-		levels:       conf.LogLevels,
-		ignoreFields: make(map[string]struct{}),
-		filters:      make(map[string]func(interface{}) interface{}),
+		pool:         pool,
+		endpoints:    endpoints,
+		sender:       conf.Sender,
+		buffer:       buffer,
+		breaker:      newBreaker(conf),
+		deadLetters:  newDeadLetters(conf.DeadLetterSize),
+		sampler:      newSampler(conf),
+		deduper:      newDeduper(conf),
+		syncLevels:   make(map[logrus.Level]struct{}),
+		staticFields: make(logrus.Fields),
 	}
 	// set default values
-	if len(hook.levels) == 0 {
-		hook.levels = defaultLevels
+	hook.applySettings(conf)
+	syncLevels := conf.SyncLevels
+	if len(syncLevels) == 0 {
+		syncLevels = defaultSyncLevels
 	}
-	if conf.DefaultTag != "" {
-		tag := conf.DefaultTag
-		hook.tag = &tag
+	for _, level := range syncLevels {
+		hook.syncLevels[level] = struct{}{}
 	}
-	if conf.DefaultMessageField != "" {
-		hook.messageField = conf.DefaultMessageField
-	} else {
-		hook.messageField = MessageField
+	if conf.TagTemplate != "" {
+		hook.tagTemplate = parseTagTemplate(conf.TagTemplate)
 	}
-
-	for k, v := range conf.DefaultIgnoreFields {
-		hook.ignoreFields[k] = v
+	if conf.MessageTemplate != "" {
+		hook.messageTemplate = parseTagTemplate(conf.MessageTemplate)
+	}
+	if conf.AddBuildVersion {
+		for k, v := range readBuildInfoFields(conf.BuildVersionField, conf.BuildRevisionField) {
+			hook.staticFields[k] = v
+		}
+	}
+	for k, v := range processFields(conf) {
+		hook.staticFields[k] = v
+	}
+	for k, v := range conf.StaticFields {
+		hook.staticFields[k] = v
+	}
+	if conf.ECS {
+		hook.hostname, _ = os.Hostname()
+		hook.ecsFieldNames = ecsFieldNames(conf.ECSFieldNames)
+	}
+	if size := asyncBufferSize(conf); size > 0 {
+		hook.startWorker(size, replay)
+	}
+	hook.sendTimeout.Store(int64(conf.SendTimeout))
+	if hook.needsHealthCheck(conf.HealthCheckInterval) {
+		hook.startHealthCheck(conf.HealthCheckInterval)
+	}
+	if conf.SampleSummaryInterval > 0 {
+		hook.sampleSummary = startPeriodic(conf.SampleSummaryInterval, hook.sendSampleSummary)
 	}
-	for k, v := range conf.DefaultFilters {
-		hook.filters[k] = v
+	if hook.deduper != nil {
+		hook.dedupFlush = startPeriodic(conf.DedupWindow, func() { hook.sendRepeats(false) })
 	}
 
 	return hook, nil
@@ -115,117 +273,440 @@ func NewHook(host string, port int) *FluentHook {
 	return hook
 }
 
+// Clients returns the active fluentd clients for advanced usage.
+// A new client is created for every logging with Config.DialPerSend,
+// so nothing is returned in that case.
+// Mutating the clients concurrently with Fire is unsafe.
+func (hook *FluentHook) Clients() []*client.Client {
+	_, pool := hook.connections()
+	if len(pool) == 0 {
+		return nil
+	}
+	clients := make([]*client.Client, len(pool))
+	for i, p := range pool {
+		clients[i] = p.client
+	}
+	return clients
+}
+
 // Levels returns logging level to fire this hook.
 func (hook *FluentHook) Levels() []logrus.Level {
+	hook.confMu.RLock()
+	defer hook.confMu.RUnlock()
 	return hook.levels
 }
 
 // SetLevels sets logging level to fire this hook.
+// logrus reads the levels on AddHook, so add the hook again to apply them.
 func (hook *FluentHook) SetLevels(levels []logrus.Level) {
+	hook.confMu.Lock()
+	defer hook.confMu.Unlock()
 	hook.levels = levels
 }
 
+// levelsUpTo returns the levels from PanicLevel to the level.
+func levelsUpTo(level logrus.Level) []logrus.Level {
+	var levels []logrus.Level
+	for _, l := range logrus.AllLevels {
+		if l <= level {
+			levels = append(levels, l)
+		}
+	}
+	return levels
+}
+
+// isSyncLevel checks the entry of the level must be sent synchronously or not.
+// Panic and Fatal entries are usually followed by the process exit,
+// so they should not wait in any buffer.
+func (hook *FluentHook) isSyncLevel(level logrus.Level) bool {
+	_, ok := hook.syncLevels[level]
+	return ok
+}
+
 // Tag returns custom static tag.
 func (hook *FluentHook) Tag() string {
-	if hook.tag == nil {
+	tag := hook.staticTag()
+	if tag == nil {
 		return ""
 	}
 
-	return *hook.tag
+	return *tag
+}
+
+// staticTag returns custom static tag, or nil if it isn't set.
+func (hook *FluentHook) staticTag() *string {
+	hook.confMu.RLock()
+	defer hook.confMu.RUnlock()
+	return hook.tag
 }
 
 // SetTag sets custom static tag to override tag in the message fields.
 func (hook *FluentHook) SetTag(tag string) {
+	hook.confMu.Lock()
+	defer hook.confMu.Unlock()
 	hook.tag = &tag
 }
 
+// SetTagPrefix sets the prefix joined to every tag with ".".
+func (hook *FluentHook) SetTagPrefix(prefix string) {
+	hook.confMu.Lock()
+	defer hook.confMu.Unlock()
+	hook.tagPrefix = prefix
+}
+
+// SetErrorHandler sets the handler called when the entry finally fails to send,
+// after the retries and in the background worker of the async mode, with *SendError.
+// The entry is the copy taken in Fire, and nil removes the handler.
+func (hook *FluentHook) SetErrorHandler(fn func(entry *logrus.Entry, err error)) {
+	if fn == nil {
+		hook.errorHandler.Store(nil)
+		return
+	}
+	hook.errorHandler.Store(&fn)
+}
+
+// copyEntry copies the entry for SetErrorHandler, as logrus reuses the entry after Fire.
+func copyEntry(entry *logrus.Entry) *logrus.Entry {
+	data := make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		data[k] = v
+	}
+	return &logrus.Entry{
+		Logger:  entry.Logger,
+		Data:    data,
+		Time:    entry.Time,
+		Level:   entry.Level,
+		Caller:  entry.Caller,
+		Message: entry.Message,
+		Context: entry.Context,
+	}
+}
+
 // SetMessageField sets custom message field.
 func (hook *FluentHook) SetMessageField(messageField string) {
+	hook.confMu.Lock()
+	defer hook.confMu.Unlock()
 	hook.messageField = messageField
 }
 
+// messageFieldName returns custom message field.
+func (hook *FluentHook) messageFieldName() string {
+	hook.confMu.RLock()
+	defer hook.confMu.RUnlock()
+	return hook.messageField
+}
+
 // AddIgnore adds field name to ignore.
 func (hook *FluentHook) AddIgnore(name string) {
+	hook.filterMu.Lock()
+	defer hook.filterMu.Unlock()
 	hook.ignoreFields[name] = struct{}{}
 }
 
+// SetAllowList forwards only the fields of the names, besides the tag, message and level fields,
+// like Config.AllowedFields. nil forwards all fields.
+func (hook *FluentHook) SetAllowList(names []string) {
+	allowFields := newAllowFields(names)
+	hook.filterMu.Lock()
+	defer hook.filterMu.Unlock()
+	hook.allowFields = allowFields
+}
+
+// newAllowFields returns the set of the names, or nil when names is nil.
+func newAllowFields(names []string) map[string]struct{} {
+	if names == nil {
+		return nil
+	}
+	allowFields := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		allowFields[name] = struct{}{}
+	}
+	return allowFields
+}
+
+// isAllowed reports whether the field of the entry is forwarded by the allow-list.
+// The caller must hold filterMu.
+func (hook *FluentHook) isAllowed(name string) bool {
+	if hook.allowFields == nil {
+		return true
+	}
+	if _, ok := hook.allowFields[name]; ok {
+		return true
+	}
+	return hook.isReservedField(name)
+}
+
+// isReservedField reports whether the field is used for the tag, the level or the message.
+func (hook *FluentHook) isReservedField(name string) bool {
+	levelField := hook.conf.LevelField
+	if levelField == "" {
+		levelField = LevelField
+	}
+	return name == TagField || name == levelField || name == hook.messageFieldName()
+}
+
 // AddFilter adds a custom filter function.
 func (hook *FluentHook) AddFilter(name string, fn func(interface{}) interface{}) {
+	hook.filterMu.Lock()
+	defer hook.filterMu.Unlock()
 	hook.filters[name] = fn
 }
 
+// AddGlobalFilter adds a custom filter function applied to every field and the message.
+// The field is filtered in this order: ignore fields, the filter of AddFilter,
+// and the global filters in the order they're added.
+func (hook *FluentHook) AddGlobalFilter(fn func(key string, value interface{}) interface{}) {
+	hook.filterMu.Lock()
+	defer hook.filterMu.Unlock()
+	hook.globalFilters = append(hook.globalFilters, fn)
+}
+
+// AddGlobalKeyFilter adds a custom filter function applied to every log field after the global filters.
+// It returns the new key and value, and false to drop the field.
+// Unlike AddGlobalFilter, it isn't applied to the message.
+func (hook *FluentHook) AddGlobalKeyFilter(fn func(key string, value interface{}) (string, interface{}, bool)) {
+	hook.filterMu.Lock()
+	defer hook.filterMu.Unlock()
+	hook.keyFilters = append(hook.keyFilters, fn)
+}
+
 // AddCustomizer adds a custom function to modify data.
 func (hook *FluentHook) AddCustomizer(fn func(entry *logrus.Entry, data logrus.Fields)) {
+	hook.AddInterceptor(func(entry *logrus.Entry, data logrus.Fields) bool {
+		fn(entry, data)
+		return true
+	})
+}
+
+// AddInterceptor adds a custom function to modify data, which skips sending the entry by returning false.
+// It runs with the customizers in the added order, and the following ones are not called after the skip.
+// The skipped entries are counted in Stats.Intercepted.
+func (hook *FluentHook) AddInterceptor(fn func(entry *logrus.Entry, data logrus.Fields) bool) {
+	hook.filterMu.Lock()
+	defer hook.filterMu.Unlock()
 	hook.customizers = append(hook.customizers, fn)
 }
 
 // Fire is invoked by logrus and sends log to fluentd logger.
+// It gives up waiting after Config.SendTimeout, see FireContext.
 func (hook *FluentHook) Fire(entry *logrus.Entry) error {
-	var logger *client.Client
-	var err error
-
-	switch {
-	case hook.Fluent != nil:
-		logger = hook.Fluent
-	default:
-		logger = client.New(client.ConnectionOptions{
-			Factory: &client.ConnFactory{
-				Address: fmt.Sprintf("%s:%d", hook.conf.Host, hook.conf.Port),
-			},
-		})
-		err := logger.Connect()
-
-		//logger, err = fluent.New(hook.conf.FluentConfig())
+	timeout := time.Duration(hook.sendTimeout.Load())
+	if timeout <= 0 {
+		return hook.FireContext(context.Background(), entry)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return hook.FireContext(ctx, entry)
+}
 
-		if err != nil {
-			return err
-		}
-		defer logger.Disconnect()
+// FireContext sends the entry like Fire, but returns the error of the context
+// (e.g. context.DeadlineExceeded) when it's done before the entry is sent,
+// or before it's buffered in the async mode.
+// The abandoned send continues in the background, and its failure is handled as usual.
+// Panic and Fatal entries are always waited for.
+func (hook *FluentHook) FireContext(ctx context.Context, entry *logrus.Entry) error {
+	if hook.isClosed() {
+		return ErrClosed
+	}
+	if !hook.sampler.sample(entry) {
+		hook.drop()
+		return nil
 	}
 
 	// Create a map for passing to FluentD
 	data := make(logrus.Fields)
+	var options map[string]string
+	var extra logrus.Fields
+	hook.filterMu.RLock()
 	for k, v := range entry.Data {
+		if k == MessageOptionsField {
+			options, _ = v.(map[string]string)
+			continue
+		}
 		if _, ok := hook.ignoreFields[k]; ok {
 			continue
 		}
+		target := data
+		if !hook.isAllowed(k) {
+			if hook.conf.ExtraField == "" {
+				continue
+			}
+			if extra == nil {
+				extra = make(logrus.Fields)
+			}
+			target = extra
+		}
 		if fn, ok := hook.filters[k]; ok {
 			v = fn(v)
 		}
-		data[k] = v
+		v = hook.applyGlobalFilters(k, v)
+		var keep bool
+		if k, v, keep = hook.applyKeyFilters(k, v); !keep {
+			continue
+		}
+		if name, ok := hook.conf.FieldRenames[k]; ok {
+			k = name
+		}
+		if hook.conf.AccumulateField[k] {
+			v = accumulateValue(v)
+		}
+		if stack := errorStack(v, hook.conf.ErrorFormat); stack != "" {
+			target[k+ErrorStackSuffix] = stack
+		}
+		target[k] = formatError(v, hook.conf.ErrorFormat)
 	}
-
-	setLevelString(entry, data)
+	if extra != nil {
+		data[hook.conf.ExtraField] = extra
+	}
+	data = transformKeys(data, hook.conf.KeyTransformer)
+	hook.setContextFields(entry, data)
+	hook.setCallerFields(entry, data)
+	limitFields(data, hook.conf.MaxFields, hook.conf.FieldOverflowPolicy, hook.conf.MaxOverflowFields, hook.isReservedField)
+	hook.setStaticFields(data)
+	hook.setDefaultFields(data, hook.conf.LevelFields[entry.Level])
+
+	hook.setLevel(entry, data)
+	hook.setTimestamp(entry, data)
 	hook.setMessage(entry, data)
+	customizers := hook.customizers
+	hook.filterMu.RUnlock()
 
 	// modify data to your own needs.
-	for _, fn := range hook.customizers {
-		fn(entry, data)
+	for _, fn := range customizers {
+		if !fn(entry, data) {
+			hook.stats.intercepted.Add(1)
+			return nil
+		}
+	}
+	tag := hook.suffixTag(hook.prefixTag(hook.getTagAndDel(entry, data)), entry.Level)
+	if !hook.sampler.limitTag(entry.Level, tag) {
+		hook.drop()
+		return nil
+	}
+	if fields, ok := hook.conf.TagFields[tag]; ok {
+		hook.filterMu.RLock()
+		hook.setDefaultFields(data, fields)
+		hook.filterMu.RUnlock()
+	}
+	if hook.conf.RecordTagAs != "" {
+		data[hook.conf.RecordTagAs] = tag
+	}
+	if hook.conf.ECS {
+		hook.setECSFields(entry, data)
+	}
+	fluentData := sanitizeKeys(convertRecord(data, TagName, hook.conf.RecordBudget, hook.conf.DisableMarshalers), hook.conf.KeySanitizer)
+	if hook.conf.FlattenFields {
+		fluentData = flattenRecord(fluentData, hook.conf.FlattenSeparator)
+	}
+	ev := &event{
+		tag:     tag,
+		data:    data,
+		record:  fluentData,
+		options: mergeOptions(hook.conf.MessageOptions, options),
+		level:   entry.Level,
+		time:    entry.Time,
+	}
+	if hook.errorHandler.Load() != nil {
+		ev.entry = copyEntry(entry)
+	}
+	if err := limitMessageSize(fluentData, hook.conf.MaxMessageSize, hook.conf.MessageSizePolicy); err != nil {
+		hook.stats.oversized.Add(1)
+		return hook.reject(ev, err)
+	}
+	if err := hook.validate(tag, data); err != nil {
+		return hook.reject(ev, err)
+	}
+	parts, err := hook.splitEvent(ev)
+	if err != nil {
+		hook.stats.oversized.Add(1)
+		return hook.reject(ev, err)
+	}
+	hook.setContentHash(tag, ev.record)
+
+	dup, repeat := hook.deduper.add(ev)
+	if repeat != nil {
+		hook.dispatch(ctx, repeat)
+	}
+	if dup {
+		hook.stats.deduplicated.Add(1)
+		return nil
+	}
+
+	ev.mirror = true
+	err = hook.dispatch(ctx, ev)
+	for _, part := range parts {
+		part.mirror = true
+		if e := hook.dispatch(ctx, part); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// dispatch sends the event synchronously, or buffers it in the async mode.
+func (hook *FluentHook) dispatch(ctx context.Context, ev *event) error {
+	switch {
+	case ev.level <= logrus.FatalLevel || hook.isSyncLevel(ev.level):
+		return hook.deliverCritical(ev)
+	case hook.queue != nil && !hook.isSyncLevel(ev.level):
+		return hook.enqueue(ctx, ev)
+	default:
+		return hook.deliverContext(ctx, ev)
+	}
+}
+
+// validate checks the record by the validator in the config.
+func (hook *FluentHook) validate(tag string, data logrus.Fields) error {
+	if hook.conf.RecordValidator == nil {
+		return nil
+	}
+	err := hook.conf.RecordValidator(tag, data)
+	if err != nil {
+		hook.stats.validationFailed.Add(1)
 	}
-	tag := hook.getTagAndDel(entry, data)
-	fluentData := ConvertToValue(data, TagName)
-	err = logger.SendMessage(tag, fluentData)
 	return err
 }
 
 // getTagAndDel extracts tag data from log entry and custom log fields.
-// 1. if tag is set in the hook, use it.
-// 2. if tag is set in custom fields, use it.
-// 3. if cannot find tag data, use entry.Message as tag.
+// 1. if Config.TagByLevel has the tag of the level, or TagByLevelDefault is set, use it.
+// 2. if tag is set in the hook, use it.
+// 3. if Config.TagFunc returns non-empty tag, use it.
+// 4. if tag is set in custom fields, use it.
+// 5. if any of tag routes matches, use it.
+// 6. if cannot find tag data, use entry.Message as tag.
 func (hook *FluentHook) getTagAndDel(entry *logrus.Entry, data logrus.Fields) string {
+	if tag := hook.levelTag(entry.Level); tag != "" {
+		delete(data, TagField)
+		return tag
+	}
+
 	// use static tag from
-	if hook.tag != nil {
-		return *hook.tag
+	if tag := hook.staticTag(); tag != nil {
+		return *tag
+	}
+
+	if hook.conf.TagFunc != nil {
+		if tag := hook.conf.TagFunc(entry); tag != "" {
+			delete(data, TagField)
+			return tag
+		}
+	}
+
+	if hook.tagTemplate != nil {
+		tag := hook.tagTemplate.render(entry, data)
+		// the tag field is consumed as the tag even if the template doesn't use it.
+		delete(data, TagField)
+		return tag
 	}
 
 	tagField, ok := data[TagField]
 	if !ok {
-		return entry.Message
+		return hook.routeTagOrMessage(entry, data)
 	}
 
 	tag, ok := tagField.(string)
 	if !ok {
-		return entry.Message
+		return hook.routeTagOrMessage(entry, data)
 	}
 
 	// remove tag from data fields
@@ -233,18 +714,251 @@ func (hook *FluentHook) getTagAndDel(entry *logrus.Entry, data logrus.Fields) st
 	return tag
 }
 
+// prefixTag joins the tag prefix and the tag with ".".
+func (hook *FluentHook) prefixTag(tag string) string {
+	hook.confMu.RLock()
+	prefix := hook.tagPrefix
+	hook.confMu.RUnlock()
+
+	if prefix == "" {
+		return tag
+	}
+	if strings.HasSuffix(prefix, ".") {
+		return prefix + tag
+	}
+	return prefix + "." + tag
+}
+
+// suffixTag appends the level to the tag with "." if TagLevelSuffix is set.
+func (hook *FluentHook) suffixTag(tag string, level logrus.Level) string {
+	if !hook.conf.TagLevelSuffix {
+		return tag
+	}
+	return tag + "." + level.String()
+}
+
+// levelTag returns the tag of the level by Config.TagByLevel, or "" when it isn't routed.
+func (hook *FluentHook) levelTag(level logrus.Level) string {
+	if tag := hook.conf.TagByLevel[level]; tag != "" {
+		return tag
+	}
+	return hook.conf.TagByLevelDefault
+}
+
+// routeTagOrMessage returns the tag from the routes or entry.Message.
+func (hook *FluentHook) routeTagOrMessage(entry *logrus.Entry, data logrus.Fields) string {
+	if tag, ok := hook.routeTag(data); ok {
+		return tag
+	}
+	return entry.Message
+}
+
+// setStaticFields adds the fields computed on the hook creation.
+// The fields in the entry are not overwritten.
+func (hook *FluentHook) setStaticFields(data logrus.Fields) {
+	hook.setDefaultFields(data, hook.staticFields)
+}
+
+// setDefaultFields adds the fields which are not in the data, except the ignore fields.
+func (hook *FluentHook) setDefaultFields(data logrus.Fields, fields map[string]interface{}) {
+	for k, v := range fields {
+		if _, ok := hook.ignoreFields[k]; ok {
+			continue
+		}
+		if _, ok := data[k]; ok {
+			continue
+		}
+		data[k] = v
+	}
+}
+
+// setContextFields adds the fields from the context extractors.
+// The fields in the entry are not overwritten.
+func (hook *FluentHook) setContextFields(entry *logrus.Entry, data logrus.Fields) {
+	if len(hook.conf.ContextExtractors) == 0 {
+		return
+	}
+
+	ctx := entry.Context
+	if ctx == nil {
+		ctx = hook.conf.DefaultContext
+	}
+	if ctx == nil {
+		return
+	}
+
+	for _, fn := range hook.conf.ContextExtractors {
+		for k, v := range fn(ctx) {
+			if _, ok := hook.ignoreFields[k]; ok {
+				continue
+			}
+			if _, ok := data[k]; ok {
+				continue
+			}
+			data[k] = v
+		}
+	}
+}
+
+// MessageFieldMode decides how entry.Message is set into the record.
+// The field in the entry is never overwritten in any mode.
+type MessageFieldMode int
+
+const (
+	// MessageFieldDefault sets the message into the message field, even if it's empty.
+	MessageFieldDefault MessageFieldMode = iota
+	// MessageFieldOmitEmpty doesn't set the empty message.
+	MessageFieldOmitEmpty
+	// MessageFieldLog sets the message into LogField instead of the message field,
+	// like the docker logging driver.
+	MessageFieldLog
+	// MessageFieldTemplate sets the message rendered by Config.MessageTemplate.
+	MessageFieldTemplate
+)
+
+// LogField is the field name of the message with MessageFieldLog.
+const LogField = "log"
+
 func (hook *FluentHook) setMessage(entry *logrus.Entry, data logrus.Fields) {
-	if _, ok := data[hook.messageField]; ok {
+	field := hook.messageFieldName()
+	if hook.conf.MessageFieldMode == MessageFieldLog {
+		field = LogField
+	}
+	if _, ok := data[field]; ok {
 		return
 	}
 
 	var v interface{} = entry.Message
-	if fn, ok := hook.filters[hook.messageField]; ok {
+	switch hook.conf.MessageFieldMode {
+	case MessageFieldOmitEmpty:
+		if entry.Message == "" {
+			return
+		}
+	case MessageFieldTemplate:
+		if hook.messageTemplate != nil {
+			v = hook.messageTemplate.render(entry, data)
+		}
+	}
+	if fn, ok := hook.filters[field]; ok {
 		v = fn(v)
 	}
-	data[hook.messageField] = v
+	data[field] = hook.applyGlobalFilters(field, v)
+}
+
+func (hook *FluentHook) applyGlobalFilters(key string, value interface{}) interface{} {
+	for _, fn := range hook.globalFilters {
+		value = fn(key, value)
+	}
+	return value
 }
 
-func setLevelString(entry *logrus.Entry, data logrus.Fields) {
-	data["level"] = entry.Level.String()
+func (hook *FluentHook) applyKeyFilters(key string, value interface{}) (string, interface{}, bool) {
+	for _, fn := range hook.keyFilters {
+		var keep bool
+		if key, value, keep = fn(key, value); !keep {
+			return key, value, false
+		}
+	}
+	return key, value, true
+}
+
+// LevelFormat is the format of the log level in the record.
+type LevelFormat int
+
+const (
+	// LevelFormatString sends the level string of logrus, e.g. "warning".
+	LevelFormatString LevelFormat = iota
+	// LevelFormatUpper sends the uppercase level string, e.g. "WARNING".
+	LevelFormatUpper
+	// LevelFormatSyslog sends the syslog severity of the level. (see SyslogSeverity)
+	LevelFormatSyslog
+	// LevelFormatOmit doesn't send the level, and the field in the entry is kept.
+	LevelFormatOmit
+)
+
+// setLevel sets the level in the format of LevelFormat,
+// or the syslog severity if LevelAsNumber is set.
+func (hook *FluentHook) setLevel(entry *logrus.Entry, data logrus.Fields) {
+	field := hook.conf.LevelField
+	if field == "" {
+		field = LevelField
+	}
+	format := hook.conf.LevelFormat
+	if hook.conf.LevelAsNumber {
+		format = LevelFormatSyslog
+	}
+
+	switch format {
+	case LevelFormatUpper:
+		if v, ok := upperLevelValues[entry.Level]; ok {
+			data[field] = v
+		} else {
+			data[field] = strings.ToUpper(entry.Level.String())
+		}
+	case LevelFormatSyslog:
+		data[field] = SyslogSeverity(entry.Level)
+	case LevelFormatOmit:
+	default:
+		if v, ok := levelValues[entry.Level]; ok {
+			data[field] = v
+		} else {
+			data[field] = entry.Level.String()
+		}
+	}
+}
+
+// levelValues and upperLevelValues are the level strings boxed once,
+// as logrus.Level.String allocates on every call.
+var levelValues, upperLevelValues = newLevelValues()
+
+func newLevelValues() (map[logrus.Level]interface{}, map[logrus.Level]interface{}) {
+	lower := make(map[logrus.Level]interface{}, len(logrus.AllLevels))
+	upper := make(map[logrus.Level]interface{}, len(logrus.AllLevels))
+	for _, level := range logrus.AllLevels {
+		lower[level] = level.String()
+		upper[level] = strings.ToUpper(level.String())
+	}
+	return lower, upper
+}
+
+// SyslogSeverity returns the syslog severity of the level. (RFC 5424)
+func SyslogSeverity(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel:
+		return 0 // Emergency
+	case logrus.FatalLevel:
+		return 2 // Critical
+	case logrus.ErrorLevel:
+		return 3 // Error
+	case logrus.WarnLevel:
+		return 4 // Warning
+	case logrus.InfoLevel:
+		return 6 // Informational
+	default:
+		return 7 // Debug
+	}
+}
+
+// setTimestamp adds the formatted entry time when TimestampField is set.
+// The field in the entry is not overwritten.
+func (hook *FluentHook) setTimestamp(entry *logrus.Entry, data logrus.Fields) {
+	if hook.conf.TimestampField == "" {
+		return
+	}
+	if _, ok := data[hook.conf.TimestampField]; ok {
+		return
+	}
+
+	switch format := hook.conf.TimestampFormat; format {
+	case "":
+		data[hook.conf.TimestampField] = entry.Time.Format(time.RFC3339Nano)
+	case TimestampEpochSeconds:
+		data[hook.conf.TimestampField] = entry.Time.Unix()
+	case TimestampEpochMillis:
+		data[hook.conf.TimestampField] = entry.Time.UnixMilli()
+	case TimestampEpochNanos:
+		data[hook.conf.TimestampField] = entry.Time.UnixNano()
+	default:
+		data[hook.conf.TimestampField] = entry.Time.Format(format)
+	}
 }
@@ -2,14 +2,22 @@ package logrus_fluent
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/IBM/fluent-forward-go/fluent/protocol"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/tinylib/msgp/msgp"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
 )
 
 var (
@@ -108,13 +116,30 @@ func TestNewHook(t *testing.T) {
 		t.Errorf("hook.port should be %d, but %d", testPort, hook.conf.Port)
 	case len(hook.levels) != len(defaultLevels):
 		t.Errorf("hook.levels should be defaultLevels")
-	case hook.Fluent != nil:
-		t.Errorf("hook.Fluent should be nil")
+	case hook.Fluent == nil:
+		t.Errorf("hook.Fluent should not be nil")
 	case hook.messageField != MessageField:
 		t.Errorf("hook.messageField should be %s", MessageField)
 	}
 }
 
+func TestClients(t *testing.T) {
+	a := assert.New(t)
+
+	hook, err := NewWithConfig(Config{Host: testHOST, Port: -1, DialPerSend: true})
+	a.NoError(err)
+	a.Empty(hook.Clients())
+
+	// the lazy client is reused instead of dialing every send.
+	a.Len(NewHook(testHOST, -1).Clients(), 1)
+
+	_, port := newMockServer(t, nil)
+	hook, err = New(testHOST, port)
+	a.NoError(err)
+	a.Len(hook.Clients(), 1)
+	a.Equal(hook.Fluent, hook.Clients()[0])
+}
+
 func TestLevels(t *testing.T) {
 	hook := FluentHook{}
 
@@ -135,6 +160,56 @@ func TestLevels(t *testing.T) {
 	}
 }
 
+func TestMinLevel(t *testing.T) {
+	a := assert.New(t)
+
+	hook, err := NewWithConfig(Config{
+		Host:                  testHOST,
+		Port:                  -1,
+		DisableConnectionPool: true,
+		MinLevel:              logrus.DebugLevel,
+	})
+	a.NoError(err)
+	a.Equal([]logrus.Level{
+		logrus.PanicLevel,
+		logrus.FatalLevel,
+		logrus.ErrorLevel,
+		logrus.WarnLevel,
+		logrus.InfoLevel,
+		logrus.DebugLevel,
+	}, hook.Levels())
+
+	// LogLevels takes precedence.
+	hook, err = NewWithConfig(Config{
+		Host:                  testHOST,
+		Port:                  -1,
+		DisableConnectionPool: true,
+		LogLevels:             []logrus.Level{logrus.ErrorLevel},
+		MinLevel:              logrus.TraceLevel,
+	})
+	a.NoError(err)
+	a.Equal([]logrus.Level{logrus.ErrorLevel}, hook.Levels())
+}
+
+func TestSyncLevels(t *testing.T) {
+	a := assert.New(t)
+
+	hook := NewHook(testHOST, -1)
+	a.True(hook.isSyncLevel(logrus.PanicLevel))
+	a.True(hook.isSyncLevel(logrus.FatalLevel))
+	a.False(hook.isSyncLevel(logrus.ErrorLevel))
+
+	hook, err := NewWithConfig(Config{
+		Host:                  testHOST,
+		Port:                  -1,
+		DisableConnectionPool: true,
+		SyncLevels:            []logrus.Level{logrus.ErrorLevel},
+	})
+	a.NoError(err)
+	a.True(hook.isSyncLevel(logrus.ErrorLevel))
+	a.False(hook.isSyncLevel(logrus.PanicLevel))
+}
+
 func TestLevelWithCustomizers(t *testing.T) {
 	a := assert.New(t)
 
@@ -160,6 +235,39 @@ func TestLevelWithCustomizers(t *testing.T) {
 	assertHook(t, hook, fields, "test message", assertFunc, data)
 }
 
+func TestAddInterceptor(t *testing.T) {
+	a := assert.New(t)
+
+	sender := testutil.NewMockSender()
+	hook, err := NewWithConfig(Config{
+		Sender:     sender,
+		DefaultTag: staticTag,
+	})
+	a.NoError(err)
+
+	var called []string
+	hook.AddCustomizer(func(entry *logrus.Entry, data logrus.Fields) {
+		called = append(called, "customizer")
+	})
+	hook.AddInterceptor(func(entry *logrus.Entry, data logrus.Fields) bool {
+		called = append(called, "interceptor")
+		return data["secret"] == nil
+	})
+	hook.AddCustomizer(func(entry *logrus.Entry, data logrus.Fields) {
+		called = append(called, "last")
+	})
+
+	a.NoError(hook.Fire(newEntry(logrus.Fields{"secret": "value"}, entryMessage)))
+	a.Equal([]string{"customizer", "interceptor"}, called)
+	a.Empty(sender.Messages())
+	a.EqualValues(1, hook.Stats().Intercepted)
+
+	called = nil
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.Equal([]string{"customizer", "interceptor", "last"}, called)
+	a.Len(sender.Messages(), 1)
+}
+
 func TestSetLevels(t *testing.T) {
 	hook := FluentHook{}
 
@@ -277,6 +385,255 @@ func TestAddFilter(t *testing.T) {
 	}
 }
 
+func TestAllowList(t *testing.T) {
+	a := assert.New(t)
+
+	sender := testutil.NewMockSender()
+	hook, err := NewWithConfig(Config{
+		Sender:        sender,
+		AllowedFields: []string{"user_id"},
+		StaticFields:  logrus.Fields{"service": "api"},
+	})
+	a.NoError(err)
+
+	fields := logrus.Fields{"user_id": 1, "email": "user@example.com", TagField: staticTag, MessageField: "msg"}
+	a.NoError(hook.Fire(newEntry(fields, entryMessage)))
+	a.Equal(map[string]interface{}{
+		"user_id":    1,
+		"service":    "api",
+		MessageField: "msg",
+		LevelField:   "error",
+	}, sender.Messages()[0].Record)
+	a.Equal(staticTag, sender.Messages()[0].Tag)
+
+	// the other fields are moved into ExtraField.
+	hook.conf.ExtraField = "extra"
+	sender.Reset()
+	a.NoError(hook.Fire(newEntry(fields, entryMessage)))
+	record := sender.Messages()[0].Record.(map[string]interface{})
+	a.Equal(map[string]interface{}{"email": "user@example.com"}, record["extra"])
+	a.Equal(1, record["user_id"])
+
+	// nil forwards all fields.
+	hook.SetAllowList(nil)
+	sender.Reset()
+	a.NoError(hook.Fire(newEntry(fields, entryMessage)))
+	record = sender.Messages()[0].Record.(map[string]interface{})
+	a.Equal("user@example.com", record["email"])
+	a.NotContains(record, "extra")
+
+	hook.SetAllowList([]string{})
+	sender.Reset()
+	a.NoError(hook.Fire(newEntry(fields, entryMessage)))
+	record = sender.Messages()[0].Record.(map[string]interface{})
+	a.NotContains(record, "user_id")
+	a.Equal(map[string]interface{}{"email": "user@example.com", "user_id": 1}, record["extra"])
+}
+
+func TestAddFilterConcurrently(t *testing.T) {
+	a := assert.New(t)
+
+	port, _ := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:                  testHOST,
+		Port:                  port,
+		DisableConnectionPool: true,
+	})
+	a.NoError(err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < defaultLoopCount; i++ {
+		key := fmt.Sprintf("key%d", i)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			hook.AddIgnore(key)
+			hook.AddFilter(key, FilterError)
+			hook.AddGlobalFilter(func(_ string, v interface{}) interface{} { return v })
+			hook.AddCustomizer(func(*logrus.Entry, logrus.Fields) {})
+			hook.SetTag(key)
+			hook.SetTagPrefix(key)
+			hook.SetMessageField(key)
+			hook.SetLevels(hook.Levels())
+		}()
+		go func() {
+			defer wg.Done()
+			a.NoError(hook.Fire(newEntry(logrus.Fields{key: fieldValue}, entryMessage)))
+		}()
+	}
+	wg.Wait()
+	a.Len(hook.filters, defaultLoopCount)
+}
+
+func TestSetLevel(t *testing.T) {
+	a := assert.New(t)
+
+	entry := &logrus.Entry{Level: logrus.WarnLevel}
+	hook := &FluentHook{}
+	data := logrus.Fields{}
+	hook.setLevel(entry, data)
+	a.Equal(logrus.Fields{LevelField: "warning"}, data)
+
+	hook.conf.LevelField = "severity"
+	hook.conf.LevelAsNumber = true
+	data = logrus.Fields{}
+	hook.setLevel(entry, data)
+	a.Equal(logrus.Fields{"severity": 4}, data)
+
+	hook.conf.LevelAsNumber = false
+	hook.conf.LevelFormat = LevelFormatUpper
+	data = logrus.Fields{}
+	hook.setLevel(entry, data)
+	a.Equal(logrus.Fields{"severity": "WARNING"}, data)
+
+	hook.conf.LevelFormat = LevelFormatOmit
+	data = logrus.Fields{"severity": "user value"}
+	hook.setLevel(entry, data)
+	a.Equal(logrus.Fields{"severity": "user value"}, data)
+
+	a.Equal(0, SyslogSeverity(logrus.PanicLevel))
+	a.Equal(3, SyslogSeverity(logrus.ErrorLevel))
+	a.Equal(6, SyslogSeverity(logrus.InfoLevel))
+	a.Equal(7, SyslogSeverity(logrus.TraceLevel))
+}
+
+func TestSetMessage(t *testing.T) {
+	a := assert.New(t)
+
+	entry := &logrus.Entry{Message: "msg", Level: logrus.InfoLevel}
+	hook := &FluentHook{messageField: MessageField}
+	data := logrus.Fields{}
+	hook.setMessage(entry, data)
+	a.Equal(logrus.Fields{MessageField: "msg"}, data)
+
+	// the field in the entry is kept.
+	data = logrus.Fields{MessageField: "user value"}
+	hook.setMessage(entry, data)
+	a.Equal(logrus.Fields{MessageField: "user value"}, data)
+
+	hook.conf.MessageFieldMode = MessageFieldOmitEmpty
+	data = logrus.Fields{}
+	hook.setMessage(&logrus.Entry{}, data)
+	a.Empty(data)
+	hook.setMessage(entry, data)
+	a.Equal(logrus.Fields{MessageField: "msg"}, data)
+
+	hook.conf.MessageFieldMode = MessageFieldLog
+	data = logrus.Fields{MessageField: "user value"}
+	hook.setMessage(entry, data)
+	a.Equal(logrus.Fields{MessageField: "user value", LogField: "msg"}, data)
+
+	hook.conf.MessageFieldMode = MessageFieldTemplate
+	hook.messageTemplate = parseTagTemplate("[{field:component}] {level}: {message}")
+	data = logrus.Fields{"component": "db"}
+	hook.setMessage(entry, data)
+	a.Equal("[db] info: msg", data[MessageField])
+}
+
+func TestSetTimestamp(t *testing.T) {
+	a := assert.New(t)
+
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	entry := &logrus.Entry{Time: ts}
+
+	hook := &FluentHook{}
+	data := logrus.Fields{}
+	hook.setTimestamp(entry, data)
+	a.Empty(data)
+
+	hook.conf.TimestampField = "@timestamp"
+	hook.setTimestamp(entry, data)
+	a.Equal("2020-01-02T03:04:05.000000006Z", data["@timestamp"])
+
+	hook.conf.TimestampFormat = time.RFC3339
+	data = logrus.Fields{}
+	hook.setTimestamp(entry, data)
+	a.Equal("2020-01-02T03:04:05Z", data["@timestamp"])
+
+	hook.conf.TimestampFormat = TimestampEpochMillis
+	data = logrus.Fields{}
+	hook.setTimestamp(entry, data)
+	a.Equal(ts.UnixMilli(), data["@timestamp"])
+
+	hook.conf.TimestampFormat = TimestampEpochSeconds
+	data = logrus.Fields{}
+	hook.setTimestamp(entry, data)
+	a.Equal(ts.Unix(), data["@timestamp"])
+
+	hook.conf.TimestampFormat = TimestampEpochNanos
+	data = logrus.Fields{}
+	hook.setTimestamp(entry, data)
+	a.Equal(ts.UnixNano(), data["@timestamp"])
+
+	data = logrus.Fields{"@timestamp": "original"}
+	hook.setTimestamp(entry, data)
+	a.Equal("original", data["@timestamp"])
+}
+
+func TestAddGlobalFilter(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host: testHOST,
+		Port: port,
+	})
+	a.NoError(err)
+
+	hook.AddFilter("token", func(v interface{}) interface{} {
+		return v.(string) + "-filtered"
+	})
+	hook.AddGlobalFilter(func(key string, v interface{}) interface{} {
+		if key == "token" {
+			return "[" + v.(string) + "]"
+		}
+		return v
+	})
+	hook.AddGlobalFilter(func(key string, v interface{}) interface{} {
+		if s, ok := v.(string); ok && len(s) > 12 {
+			return s[:12]
+		}
+		return v
+	})
+
+	a.NoError(hook.Fire(newEntry(logrus.Fields{
+		"token": "secret",
+		"value": "long value of the field",
+	}, "long message of the entry")))
+	msg := receiveMessage(t, messages)
+	a.Equal("[secret-filt", msg.Record["token"])
+	a.Equal("long value o", msg.Record["value"])
+	a.Equal("long message", msg.Record[MessageField])
+}
+
+func TestAddGlobalKeyFilter(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host: testHOST,
+		Port: port,
+	})
+	a.NoError(err)
+
+	hook.AddGlobalKeyFilter(func(key string, v interface{}) (string, interface{}, bool) {
+		return key, v, !strings.HasPrefix(key, "secret_")
+	})
+	hook.AddGlobalKeyFilter(func(key string, v interface{}) (string, interface{}, bool) {
+		return strings.TrimPrefix(key, "app."), v, true
+	})
+
+	a.NoError(hook.Fire(newEntry(logrus.Fields{
+		"secret_token": "secret",
+		"app.value":    fieldValue,
+	}, entryMessage)))
+	msg := receiveMessage(t, messages)
+	a.NotContains(msg.Record, "secret_token")
+	a.NotContains(msg.Record, "app.value")
+	a.Equal(fieldValue, msg.Record["value"])
+	a.Equal(entryMessage, msg.Record[MessageField])
+}
+
 func TestLogEntryMessageReceived(t *testing.T) {
 	f := logrus.Fields{
 		"value": fieldValue,
@@ -458,6 +815,124 @@ func TestLogEntryStaticTagWithTagAndMessage(t *testing.T) {
 	assertLogHookWithStaticTag(t, f, entryMessage, assertion)
 }
 
+func TestRecordTagAs(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:        testHOST,
+		Port:        port,
+		RecordTagAs: "fluent_tag",
+	})
+	a.NoError(err)
+
+	tests := []struct {
+		fields   logrus.Fields
+		expected string
+	}{
+		{logrus.Fields{"tag": fieldTag}, fieldTag},
+		{logrus.Fields{"value": fieldValue}, entryMessage},
+	}
+	for _, tt := range tests {
+		a.NoError(hook.Fire(newEntry(tt.fields, entryMessage)))
+		msg := receiveMessage(t, messages)
+		a.Equal(tt.expected, msg.Tag)
+		a.Equal(tt.expected, msg.Record["fluent_tag"])
+		a.NotContains(msg.Record, TagField)
+	}
+}
+
+type contextKey string
+
+func TestContextExtractors(t *testing.T) {
+	a := assert.New(t)
+
+	extract := func(ctx context.Context) logrus.Fields {
+		region, _ := ctx.Value(contextKey("region")).(string)
+		return logrus.Fields{"region": region, "value": "from context"}
+	}
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:              testHOST,
+		Port:              port,
+		ContextExtractors: []func(context.Context) logrus.Fields{extract},
+		DefaultContext:    context.WithValue(context.Background(), contextKey("region"), "default"),
+	})
+	a.NoError(err)
+
+	// without entry context
+	a.NoError(hook.Fire(newEntry(logrus.Fields{"value": fieldValue}, entryMessage)))
+	msg := receiveMessage(t, messages)
+	a.Equal("default", msg.Record["region"])
+	a.Equal(fieldValue, msg.Record["value"])
+
+	// entry context wins
+	entry := newEntry(nil, entryMessage)
+	entry.Context = context.WithValue(context.Background(), contextKey("region"), "entry")
+	a.NoError(hook.Fire(entry))
+	msg = receiveMessage(t, messages)
+	a.Equal("entry", msg.Record["region"])
+	a.Equal("from context", msg.Record["value"])
+}
+
+// blockingSender is the sender stuck until release is closed.
+type blockingSender struct {
+	release chan struct{}
+}
+
+func (s *blockingSender) Connect() error    { return nil }
+func (s *blockingSender) Disconnect() error { return nil }
+func (s *blockingSender) SendMessage(tag string, record interface{}) error {
+	<-s.release
+	return nil
+}
+
+func TestFireContext(t *testing.T) {
+	a := assert.New(t)
+
+	sender := &blockingSender{release: make(chan struct{})}
+	defer close(sender.release)
+	hook, err := NewWithConfig(Config{
+		Sender:      sender,
+		DefaultTag:  staticTag,
+		SendTimeout: 10 * time.Millisecond,
+	})
+	a.NoError(err)
+
+	a.ErrorIs(hook.Fire(newEntry(nil, entryMessage)), context.DeadlineExceeded)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a.ErrorIs(hook.FireContext(ctx, newEntry(nil, entryMessage)), context.Canceled)
+}
+
+func TestFireContextAsync(t *testing.T) {
+	a := assert.New(t)
+
+	sender := &blockingSender{release: make(chan struct{})}
+	hook, err := NewWithConfig(Config{
+		Sender:          sender,
+		DefaultTag:      staticTag,
+		AsyncBufferSize: 1,
+	})
+	a.NoError(err)
+
+	// the first entry is taken by the stuck worker, and the second one fills the buffer.
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	for {
+		if err := hook.FireContext(ctx, newEntry(nil, entryMessage)); err != nil {
+			a.ErrorIs(err, context.DeadlineExceeded)
+			break
+		}
+	}
+	close(sender.release)
+	a.NoError(hook.Close())
+}
+
 func assertLogHook(t *testing.T, f logrus.Fields, message string, assertFunc func(string)) {
 	assertLogMessage(t, f, message, "", assertFunc)
 }
@@ -535,7 +1010,7 @@ func newMockServer(t *testing.T, data chan string) (net.Listener, int) {
 				t.Errorf("Error accepting: %s", err.Error())
 			}
 
-			go handleRequest(conn, l, data)
+			go handleRequestUntilEOF(conn, data)
 			if count == defaultLoopCount {
 				l.Close()
 				return
@@ -558,3 +1033,142 @@ func handleRequest(conn net.Conn, l net.Listener, data chan string) {
 		data <- string(b)
 	}
 }
+
+// handleRequestUntilEOF is handleRequest which returns when the client closes the connection,
+// e.g. the connection of the discarded hook is closed by GC.
+func handleRequestUntilEOF(conn net.Conn, data chan string) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		b := make([]byte, 1<<10) // Read 1KB at a time
+		_, err := r.Read(b)
+		if err != nil {
+			return
+		}
+		data <- string(b)
+	}
+}
+
+// receivedMessage is a decoded forward protocol message.
+type receivedMessage struct {
+	Tag     string
+	Time    interface{}
+	Record  map[string]interface{}
+	Options map[string]interface{}
+}
+
+// newMessageServer starts mock server which decodes every received message.
+func newMessageServer(t *testing.T) (int, chan receivedMessage) {
+	l, err := net.Listen("tcp", testHOST+":0")
+	if err != nil {
+		t.Fatalf("Error listening: %s", err.Error())
+	}
+	t.Cleanup(func() { l.Close() })
+
+	messages := make(chan receivedMessage, defaultLoopCount)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go decodeMessages(conn, messages)
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port, messages
+}
+
+func decodeMessages(conn net.Conn, messages chan receivedMessage) {
+	defer conn.Close()
+
+	r := msgp.NewReader(conn)
+	for {
+		msg, err := decodeMessage(r)
+		if err != nil {
+			return
+		}
+		messages <- msg
+	}
+}
+
+func decodeMessage(r *msgp.Reader) (receivedMessage, error) {
+	var msg receivedMessage
+	size, err := r.ReadArrayHeader()
+	if err != nil {
+		return msg, err
+	}
+	if msg.Tag, err = r.ReadString(); err != nil {
+		return msg, err
+	}
+	if msg.Time, err = r.ReadIntf(); err != nil {
+		return msg, err
+	}
+	msg.Record = make(map[string]interface{})
+	if err = r.ReadMapStrIntf(msg.Record); err != nil {
+		return msg, err
+	}
+	if size > 3 {
+		if typ, _ := r.NextType(); typ == msgp.NilType {
+			return msg, r.ReadNil()
+		}
+		msg.Options = make(map[string]interface{})
+		if err = r.ReadMapStrIntf(msg.Options); err != nil {
+			return msg, err
+		}
+	}
+	return msg, nil
+}
+
+func receiveMessage(t *testing.T, messages chan receivedMessage) receivedMessage {
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatalf("message is not received")
+	}
+	return receivedMessage{}
+}
+
+func newEntry(fields logrus.Fields, message string) *logrus.Entry {
+	entry := logrus.NewEntry(logrus.New()).WithFields(fields)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = message
+	entry.Time = time.Now()
+	return entry
+}
+
+// discardSender encodes the messages into io.Discard like the connection.
+type discardSender struct{}
+
+func (discardSender) Connect() error    { return nil }
+func (discardSender) Disconnect() error { return nil }
+func (discardSender) SendMessage(tag string, record interface{}) error {
+	return msgp.Encode(io.Discard, protocol.NewMessage(tag, record))
+}
+func (discardSender) Send(msg protocol.ChunkEncoder) error {
+	return msgp.Encode(io.Discard, msg)
+}
+
+func BenchmarkFire(b *testing.B) {
+	hook, err := NewWithConfig(Config{Sender: discardSender{}, DefaultTag: staticTag})
+	if err != nil {
+		b.Fatal(err)
+	}
+	entry := newEntry(logrus.Fields{
+		"user":    "alice",
+		"id":      12345,
+		"latency": 1.5,
+		"ok":      true,
+		"path":    "/api/v1/items",
+		"err":     errors.New("not found"),
+	}, entryMessage)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := hook.Fire(entry); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
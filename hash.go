@@ -0,0 +1,67 @@
+package logrus_fluent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// DefaultContentHashExclude is the volatile field names excluded from the content hash
+// when Config.ContentHashExclude is nil.
+var DefaultContentHashExclude = []string{"@timestamp", "timestamp", "time", "seq", "sequence"}
+
+// setContentHash adds SHA-256 hash of the tag and the record into the record.
+// The same event always has the same hash, so it can be used as the idempotency key.
+func (hook *FluentHook) setContentHash(tag string, record interface{}) {
+	field := hook.conf.ContentHashField
+	m, ok := record.(map[string]interface{})
+	if field == "" || !ok {
+		return
+	}
+
+	hash, err := contentHash(tag, m, hashExclude(hook.conf))
+	if err != nil {
+		return
+	}
+	m[field] = hash
+}
+
+// hashExclude returns the field names excluded from the content hash and the deduplication:
+// Config.ContentHashExclude, the hash itself, Config.TimestampField and RecordIDField,
+// which differ between the same events.
+func hashExclude(conf Config) []string {
+	exclude := conf.ContentHashExclude
+	if exclude == nil {
+		exclude = DefaultContentHashExclude
+	}
+	exclude = append(exclude[:len(exclude):len(exclude)], RecordIDField)
+	for _, field := range []string{conf.ContentHashField, conf.TimestampField} {
+		if field != "" {
+			exclude = append(exclude, field)
+		}
+	}
+	return exclude
+}
+
+// contentHash returns SHA-256 hash of the tag and the record without the excluded fields.
+func contentHash(tag string, record map[string]interface{}, exclude []string) (string, error) {
+	target := make(map[string]interface{}, len(record))
+	for k, v := range record {
+		target[k] = v
+	}
+	for _, k := range exclude {
+		delete(target, k)
+	}
+
+	// encoding/json sorts the map keys, so the result is stable.
+	b, err := json.Marshal(struct {
+		Tag    string                 `json:"tag"`
+		Record map[string]interface{} `json:"record"`
+	}{tag, target})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
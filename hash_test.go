@@ -0,0 +1,78 @@
+package logrus_fluent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetContentHash(t *testing.T) {
+	a := assert.New(t)
+
+	hook := &FluentHook{
+		conf: Config{ContentHashField: "hash"},
+	}
+	newRecord := func() map[string]interface{} {
+		return map[string]interface{}{
+			"message":    "msg",
+			"value":      map[string]interface{}{"a": 1, "b": []interface{}{"x", "y"}},
+			"@timestamp": "2020-01-01T00:00:00Z",
+		}
+	}
+
+	first := newRecord()
+	hook.setContentHash(fieldTag, first)
+	a.Len(first["hash"], 64)
+
+	// retry of the same event.
+	retry := newRecord()
+	retry["@timestamp"] = "2020-01-01T00:00:01Z"
+	hook.setContentHash(fieldTag, retry)
+	a.Equal(first["hash"], retry["hash"])
+
+	// hash is stable even if it's computed twice.
+	hook.setContentHash(fieldTag, retry)
+	a.Equal(first["hash"], retry["hash"])
+
+	changed := newRecord()
+	changed["message"] = "changed"
+	hook.setContentHash(fieldTag, changed)
+	a.NotEqual(first["hash"], changed["hash"])
+
+	other := newRecord()
+	hook.setContentHash("other.tag", other)
+	a.NotEqual(first["hash"], other["hash"])
+
+	// configured excluded fields
+	hook.conf.ContentHashExclude = []string{"message"}
+	excluded := newRecord()
+	excluded["message"] = "changed"
+	excluded["@timestamp"] = "changed"
+	hook.setContentHash(fieldTag, excluded)
+	changed = newRecord()
+	hook.setContentHash(fieldTag, changed)
+	a.NotEqual(excluded["hash"], changed["hash"])
+	changed["@timestamp"] = "changed"
+	delete(changed, "hash")
+	hook.setContentHash(fieldTag, changed)
+	a.Equal(excluded["hash"], changed["hash"])
+
+	// TimestampField and RecordIDField are always excluded, like the deduplication.
+	hook.conf.TimestampField = "logged_at"
+	first = newRecord()
+	first["logged_at"] = "2020-01-01T00:00:00Z"
+	first[RecordIDField] = "1"
+	hook.setContentHash(fieldTag, first)
+	retry = newRecord()
+	retry["logged_at"] = "2020-01-01T00:00:01Z"
+	retry[RecordIDField] = "2"
+	hook.setContentHash(fieldTag, retry)
+	a.Equal(first["hash"], retry["hash"])
+	a.Equal(hashExclude(hook.conf), newDeduper(Config{
+		DedupWindow:        time.Minute,
+		ContentHashField:   "hash",
+		ContentHashExclude: []string{"message"},
+		TimestampField:     "logged_at",
+	}).exclude)
+}
@@ -0,0 +1,100 @@
+package logrus_fluent
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ToSnakeCase converts the camelCase or PascalCase key into snake_case.
+// e.g. "userID" => "user_id", "HTTPRequest" => "http_request"
+func ToSnakeCase(key string) string {
+	runes := []rune(key)
+	var b strings.Builder
+	b.Grow(len(key) + 4)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prev != '_' && (unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower)) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// ToLower converts the key into lower case.
+func ToLower(key string) string {
+	return strings.ToLower(key)
+}
+
+// SanitizeDots replaces "." in the key with "_",
+// as the dotted keys are expanded into objects and may conflict in Elasticsearch.
+// e.g. "http.status" => "http_status"
+func SanitizeDots(key string) string {
+	return strings.ReplaceAll(key, ".", "_")
+}
+
+// SanitizeElasticsearch replaces "." in the key with "_" and trims the leading "_",
+// which is reserved for the metadata fields of Elasticsearch.
+// e.g. "_http.status" => "http_status". The key of only "_" is kept as it is.
+func SanitizeElasticsearch(key string) string {
+	if trimmed := strings.TrimLeft(key, "_"); trimmed != "" {
+		key = trimmed
+	}
+	return SanitizeDots(key)
+}
+
+// transformKeys returns the fields with the transformed keys.
+// When the keys collide, the value of the last key in sorted order wins.
+func transformKeys(data logrus.Fields, fn func(string) string) logrus.Fields {
+	if fn == nil {
+		return data
+	}
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make(logrus.Fields, len(data))
+	for _, k := range keys {
+		result[fn(k)] = data[k]
+	}
+	return result
+}
+
+// sanitizeKeys returns the record with the sanitized keys, including the keys of the nested maps.
+// When the keys collide, the value of the last key in sorted order wins.
+func sanitizeKeys(v interface{}, fn func(string) string) interface{} {
+	if fn == nil {
+		return v
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		result := make(map[string]interface{}, len(v))
+		for _, k := range keys {
+			result[fn(k)] = sanitizeKeys(v[k], fn)
+		}
+		return result
+	case []interface{}:
+		for i, e := range v {
+			v[i] = sanitizeKeys(e, fn)
+		}
+		return v
+	default:
+		return v
+	}
+}
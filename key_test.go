@@ -0,0 +1,109 @@
+package logrus_fluent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
+)
+
+func TestToSnakeCase(t *testing.T) {
+	a := assert.New(t)
+
+	tests := map[string]string{
+		"":              "",
+		"value":         "value",
+		"userId":        "user_id",
+		"userID":        "user_id",
+		"UserName":      "user_name",
+		"HTTPRequestID": "http_request_id",
+		"already_snake": "already_snake",
+		"Already_Snake": "already_snake",
+		"version2Beta":  "version2_beta",
+	}
+	for key, expected := range tests {
+		a.Equal(expected, ToSnakeCase(key), key)
+	}
+}
+
+func TestTransformKeys(t *testing.T) {
+	a := assert.New(t)
+
+	data := logrus.Fields{"userId": 1, "requestID": 2}
+	a.Equal(data, transformKeys(data, nil))
+	a.Equal(logrus.Fields{"user_id": 1, "request_id": 2}, transformKeys(data, ToSnakeCase))
+
+	// the last key in sorted order wins.
+	data = logrus.Fields{"userId": 1, "user_id": 2, "UserId": 3}
+	for i := 0; i < defaultLoopCount; i++ {
+		a.Equal(logrus.Fields{"user_id": 2}, transformKeys(data, ToSnakeCase))
+		a.Equal(logrus.Fields{"userid": 1}, transformKeys(logrus.Fields{"UserId": 0, "userId": 1}, ToLower))
+	}
+}
+
+func TestSanitizeKeys(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("http_status", SanitizeDots("http.status"))
+	a.Equal("_id", SanitizeDots("_id"))
+	a.Equal("http_status", SanitizeElasticsearch("__http.status"))
+	a.Equal("_", SanitizeElasticsearch("_"))
+
+	record := map[string]interface{}{
+		"a.b":  1,
+		"_id":  "x",
+		"list": []interface{}{map[string]interface{}{"c.d": 2}},
+		"map":  map[string]interface{}{"e.f": 3},
+	}
+	a.Equal(record, sanitizeKeys(record, nil))
+	a.Equal(map[string]interface{}{
+		"a_b":  1,
+		"id":   "x",
+		"list": []interface{}{map[string]interface{}{"c_d": 2}},
+		"map":  map[string]interface{}{"e_f": 3},
+	}, sanitizeKeys(record, SanitizeElasticsearch))
+
+	// the last key in sorted order wins.
+	a.Equal(map[string]interface{}{"a_b": 2}, sanitizeKeys(map[string]interface{}{"a.b": 1, "a_b": 2}, SanitizeDots))
+}
+
+func TestKeySanitizer(t *testing.T) {
+	a := assert.New(t)
+
+	sender := testutil.NewMockSender()
+	hook, err := NewWithConfig(Config{
+		Sender:       sender,
+		DefaultTag:   staticTag,
+		KeySanitizer: SanitizeDots,
+	})
+	a.NoError(err)
+	a.NoError(hook.Fire(newEntry(logrus.Fields{"http.status": 200}, entryMessage)))
+	if messages := sender.Messages(); a.Len(messages, 1) {
+		record := messages[0].Record.(map[string]interface{})
+		a.Equal(200, record["http_status"])
+		a.NotContains(record, "http.status")
+	}
+}
+
+func TestFieldRenames(t *testing.T) {
+	a := assert.New(t)
+
+	sender := testutil.NewMockSender()
+	hook, err := NewWithConfig(Config{
+		Sender:         sender,
+		DefaultTag:     staticTag,
+		FieldRenames:   map[string]string{"uid": "user_id"},
+		KeyTransformer: strings.ToUpper,
+	})
+	a.NoError(err)
+	a.NoError(hook.Fire(newEntry(logrus.Fields{"uid": 1, "other": 2}, entryMessage)))
+	if messages := sender.Messages(); a.Len(messages, 1) {
+		record := messages[0].Record.(map[string]interface{})
+		a.Equal(1, record["USER_ID"])
+		a.Equal(2, record["OTHER"])
+		a.NotContains(record, "UID")
+	}
+}
@@ -0,0 +1,190 @@
+package logrus_fluent
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tinylib/msgp/msgp"
+)
+
+const (
+	// OverflowField is field name to collapse the fields over Config.MaxFields.
+	OverflowField = "_overflow"
+	// DroppedFieldCountField is field name to set the number of dropped fields.
+	DroppedFieldCountField = "_dropped_field_count"
+)
+
+// FieldOverflowPolicy is the way to handle the fields over Config.MaxFields.
+type FieldOverflowPolicy int
+
+const (
+	// FieldOverflowDrop drops the overflow fields.
+	FieldOverflowDrop FieldOverflowPolicy = iota
+	// FieldOverflowCollapse moves the overflow fields into OverflowField.
+	// The fields over Config.MaxOverflowFields are dropped and counted in DroppedFieldCountField.
+	FieldOverflowCollapse
+	// FieldOverflowCount drops the overflow fields and sets the number in DroppedFieldCountField.
+	FieldOverflowCount
+)
+
+// limitFields keeps the fields up to the max number.
+// Field names are sorted to decide the kept fields deterministically.
+// The reserved fields, e.g. the tag, are always kept and not counted.
+func limitFields(data logrus.Fields, max int, policy FieldOverflowPolicy, maxOverflow int, reserved func(string) bool) {
+	if max <= 0 || len(data) <= max {
+		return
+	}
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		if reserved == nil || !reserved(k) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) <= max {
+		return
+	}
+	sort.Strings(keys)
+
+	overflow := make(map[string]interface{})
+	dropped := 0
+	for _, k := range keys[max:] {
+		if policy == FieldOverflowCollapse && (maxOverflow <= 0 || len(overflow) < maxOverflow) {
+			overflow[k] = data[k]
+		} else {
+			dropped++
+		}
+		delete(data, k)
+	}
+
+	switch policy {
+	case FieldOverflowCollapse:
+		data[OverflowField] = overflow
+		if dropped != 0 {
+			data[DroppedFieldCountField] = dropped
+		}
+	case FieldOverflowCount:
+		data[DroppedFieldCountField] = dropped
+	}
+}
+
+// TruncatedMarker is appended to the string field truncated by Config.MaxMessageSize.
+const TruncatedMarker = "...(truncated)"
+
+// ErrMessageTooLarge is returned when the record can't be sent within Config.MaxMessageSize.
+var ErrMessageTooLarge = errors.New("logrus_fluent: message is too large")
+
+// MessageSizePolicy is the way to handle the record over Config.MaxMessageSize.
+type MessageSizePolicy int
+
+const (
+	// MessageSizeTruncate truncates the longest string fields with TruncatedMarker.
+	MessageSizeTruncate MessageSizePolicy = iota
+	// MessageSizeDropField drops the largest fields.
+	MessageSizeDropField
+	// MessageSizeDropRecord drops the record with ErrMessageTooLarge.
+	MessageSizeDropRecord
+)
+
+// limitMessageSize makes the encoded record fit in the max size by the policy,
+// and sets TruncatedField when the record is cut.
+// Only the top-level fields are cut, so the record can't be cut enough in rare cases,
+// e.g. the large nested map. ErrMessageTooLarge is returned then.
+func limitMessageSize(record interface{}, max int, policy MessageSizePolicy) error {
+	if max <= 0 {
+		return nil
+	}
+	size := msgpSize(record)
+	if size <= max {
+		return nil
+	}
+	m, ok := record.(map[string]interface{})
+	if !ok || policy == MessageSizeDropRecord {
+		return ErrMessageTooLarge
+	}
+
+	m[TruncatedField] = true
+	for size = msgpSize(m); size > max; size = msgpSize(m) {
+		key, length := largestField(m, policy)
+		if key == "" {
+			return ErrMessageTooLarge
+		}
+		if policy == MessageSizeDropField {
+			delete(m, key)
+			continue
+		}
+
+		s := m[key].(string)
+		n := length - (size - max) - len(TruncatedMarker)
+		if n < 0 {
+			n = 0
+		}
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		m[key] = s[:n] + TruncatedMarker
+	}
+	return nil
+}
+
+// largestField returns the key and the size of the largest field which can be cut by the policy:
+// the string longer than TruncatedMarker for MessageSizeTruncate, or any field for MessageSizeDropField.
+// The keys are sorted to decide the field deterministically.
+func largestField(m map[string]interface{}, policy MessageSizePolicy) (string, int) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var key string
+	var max int
+	for _, k := range keys {
+		if k == TruncatedField {
+			continue
+		}
+		var size int
+		if policy == MessageSizeTruncate {
+			s, ok := m[k].(string)
+			if !ok || len(s) <= len(TruncatedMarker) {
+				continue
+			}
+			size = len(s)
+		} else {
+			size = msgpSize(m[k])
+		}
+		if size > max {
+			key, max = k, size
+		}
+	}
+	return key, max
+}
+
+// msgpSize returns the size of the value encoded in msgpack,
+// or -1 when it can't be encoded, which is left to fail on the send.
+func msgpSize(v interface{}) int {
+	buf := sizeBufPool.Get().(*[]byte)
+	b, err := msgp.AppendIntf((*buf)[:0], v)
+	if cap(b) <= maxPooledBufSize {
+		// the huge buffer isn't kept not to hold the memory
+		*buf = b[:0]
+		sizeBufPool.Put(buf)
+	}
+	if err != nil {
+		return -1
+	}
+	return len(b)
+}
+
+const maxPooledBufSize = 64 << 10
+
+// sizeBufPool is the buffers of msgpSize, which is called on every record with Config.MaxMessageSize.
+var sizeBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 1024)
+		return &b
+	},
+}
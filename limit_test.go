@@ -0,0 +1,154 @@
+package logrus_fluent
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
+)
+
+func TestLimitFields(t *testing.T) {
+	newFields := func() logrus.Fields {
+		return logrus.Fields{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}
+	}
+
+	tests := []struct {
+		max         int
+		policy      FieldOverflowPolicy
+		maxOverflow int
+		expected    logrus.Fields
+	}{
+		{0, FieldOverflowDrop, 0, newFields()},
+		{5, FieldOverflowCount, 0, newFields()},
+		{2, FieldOverflowDrop, 0, logrus.Fields{"a": 1, "b": 2}},
+		{2, FieldOverflowCount, 0, logrus.Fields{"a": 1, "b": 2, DroppedFieldCountField: 3}},
+		{2, FieldOverflowCollapse, 0, logrus.Fields{
+			"a": 1, "b": 2,
+			OverflowField: map[string]interface{}{"c": 3, "d": 4, "e": 5},
+		}},
+		{2, FieldOverflowCollapse, 2, logrus.Fields{
+			"a": 1, "b": 2,
+			OverflowField:          map[string]interface{}{"c": 3, "d": 4},
+			DroppedFieldCountField: 1,
+		}},
+	}
+
+	for _, tt := range tests {
+		data := newFields()
+		limitFields(data, tt.max, tt.policy, tt.maxOverflow, nil)
+		assert.Equal(t, tt.expected, data)
+	}
+
+	// the reserved field is kept and not counted.
+	data := newFields()
+	data["0"] = 0
+	limitFields(data, 2, FieldOverflowDrop, 0, func(k string) bool { return k == "0" })
+	assert.Equal(t, logrus.Fields{"0": 0, "a": 1, "b": 2}, data)
+}
+
+func TestMaxFieldsKeepsTag(t *testing.T) {
+	a := assert.New(t)
+
+	sender := testutil.NewMockSender()
+	hook, err := NewWithConfig(Config{
+		Sender:              sender,
+		MaxFields:           2,
+		FieldOverflowPolicy: FieldOverflowCollapse,
+	})
+	a.NoError(err)
+
+	a.NoError(hook.Fire(newEntry(logrus.Fields{"a": 1, "b": 2, "c": 3, "d": 4, TagField: fieldTag}, entryMessage)))
+	if messages := sender.Messages(); a.Len(messages, 1) {
+		a.Equal(fieldTag, messages[0].Tag)
+		record := messages[0].Record.(map[string]interface{})
+		a.NotContains(record, TagField)
+		a.Equal(map[string]interface{}{"c": 3, "d": 4}, record[OverflowField])
+		a.Equal(entryMessage, record[MessageField])
+	}
+}
+
+func TestLimitMessageSize(t *testing.T) {
+	a := assert.New(t)
+
+	newRecord := func() map[string]interface{} {
+		return map[string]interface{}{
+			"message": "short",
+			"body":    strings.Repeat("あ", 100),
+			"stack":   strings.Repeat("b", 200),
+			"list":    []interface{}{strings.Repeat("c", 50)},
+		}
+	}
+	const max = 200
+
+	r := newRecord()
+	a.NoError(limitMessageSize(r, 0, MessageSizeTruncate))
+	a.Equal(newRecord(), r)
+	a.NoError(limitMessageSize(r, 1000, MessageSizeTruncate))
+	a.Equal(newRecord(), r)
+
+	// the longest string is truncated first.
+	r = newRecord()
+	a.NoError(limitMessageSize(r, max, MessageSizeTruncate))
+	a.LessOrEqual(msgpSize(r), max)
+	a.Equal("short", r["message"])
+	a.True(strings.HasSuffix(r["stack"].(string), TruncatedMarker))
+	a.True(utf8.ValidString(r["body"].(string)))
+	a.Equal(true, r[TruncatedField])
+
+	r = newRecord()
+	a.NoError(limitMessageSize(r, max, MessageSizeDropField))
+	a.LessOrEqual(msgpSize(r), max)
+	a.NotContains(r, "body")
+	a.NotContains(r, "stack")
+	a.Equal("short", r["message"])
+
+	r = newRecord()
+	a.ErrorIs(limitMessageSize(r, max, MessageSizeDropRecord), ErrMessageTooLarge)
+
+	// the slice isn't truncated.
+	r = map[string]interface{}{"list": []interface{}{strings.Repeat("c", 500)}}
+	a.ErrorIs(limitMessageSize(r, max, MessageSizeTruncate), ErrMessageTooLarge)
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	a := assert.New(t)
+
+	var failed error
+	sender := testutil.NewMockSender()
+	hook, err := NewWithConfig(Config{
+		Sender:            sender,
+		DefaultTag:        staticTag,
+		MaxMessageSize:    100,
+		MessageSizePolicy: MessageSizeDropRecord,
+		OnError: func(err error, tag string, data logrus.Fields) {
+			failed = err
+		},
+	})
+	a.NoError(err)
+
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	err = hook.Fire(newEntry(logrus.Fields{"body": strings.Repeat("a", 100)}, entryMessage))
+	a.ErrorIs(err, ErrMessageTooLarge)
+	var sendErr *SendError
+	if a.ErrorAs(err, &sendErr) {
+		a.Equal(staticTag, sendErr.Tag)
+		a.Equal(strings.Repeat("a", 100), sendErr.Record["body"])
+		a.Zero(sendErr.Attempts)
+	}
+	a.Equal(err, failed)
+	a.Len(sender.Messages(), 1)
+	a.EqualValues(1, hook.Stats().Oversized)
+}
+
+func BenchmarkMsgpSize(b *testing.B) {
+	record := map[string]interface{}{"user": "alice", "id": 12345, "message": strings.Repeat("x", 256)}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msgpSize(record)
+	}
+}
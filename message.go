@@ -0,0 +1,117 @@
+package logrus_fluent
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sort"
+	"time"
+
+	"github.com/IBM/fluent-forward-go/fluent/protocol"
+	"github.com/sirupsen/logrus"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// MessageOptionsField is logrus field name for the message options of the entry.
+// It's not sent in the record. (see WithMessageOptions)
+const MessageOptionsField = "_fluent_message_options"
+
+// WithMessageOptions returns a new entry sent with the options in the forward message,
+// in addition to Config.MessageOptions. The options of the entry take precedence.
+//
+//	logrus_fluent.WithMessageOptions(entry, map[string]string{"datacenter": "eu-west"}).Error("msg")
+func WithMessageOptions(entry *logrus.Entry, options map[string]string) *logrus.Entry {
+	return entry.WithField(MessageOptionsField, options)
+}
+
+// mergeOptions returns the options of the config overwritten by the options of the entry.
+func mergeOptions(base, options map[string]string) map[string]string {
+	if len(options) == 0 {
+		return base
+	}
+	if len(base) == 0 {
+		return options
+	}
+	result := make(map[string]string, len(base)+len(options))
+	for k, v := range base {
+		result[k] = v
+	}
+	for k, v := range options {
+		result[k] = v
+	}
+	return result
+}
+
+// optionMessage is the forward message with the arbitrary option map,
+// as protocol.MessageOptions only has the known options.
+type optionMessage struct {
+	tag       string
+	time      time.Time
+	eventTime bool // the time is encoded as EventTime, otherwise the seconds.
+	record    interface{}
+	options   map[string]string
+	chunk     string
+}
+
+// Chunk returns the chunk id sent in the options for the acknowledgement.
+func (m *optionMessage) Chunk() (string, error) {
+	if m.chunk != "" {
+		return m.chunk, nil
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	m.chunk = base64.StdEncoding.EncodeToString(b)
+	return m.chunk, nil
+}
+
+// EncodeMsg implements msgp.Encodable.
+func (m *optionMessage) EncodeMsg(w *msgp.Writer) error {
+	if err := w.WriteArrayHeader(4); err != nil {
+		return err
+	}
+	if err := w.WriteString(m.tag); err != nil {
+		return err
+	}
+	if m.eventTime {
+		if err := w.WriteExtension(&protocol.EventTime{Time: m.time}); err != nil {
+			return err
+		}
+	} else if err := w.WriteInt64(m.time.Unix()); err != nil {
+		return err
+	}
+	if err := w.WriteIntf(m.record); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(m.options))
+	for k := range m.options {
+		if k != "chunk" || m.chunk == "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	size := uint32(len(keys))
+	if m.chunk != "" {
+		size++
+	}
+	if err := w.WriteMapHeader(size); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := w.WriteString(k); err != nil {
+			return err
+		}
+		if err := w.WriteString(m.options[k]); err != nil {
+			return err
+		}
+	}
+	if m.chunk != "" {
+		if err := w.WriteString("chunk"); err != nil {
+			return err
+		}
+		return w.WriteString(m.chunk)
+	}
+	return nil
+}
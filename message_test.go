@@ -0,0 +1,66 @@
+package logrus_fluent
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tinylib/msgp/msgp"
+)
+
+func TestMessageOptions(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:           testHOST,
+		Port:           port,
+		MessageOptions: map[string]string{"datacenter": "eu-west", "source": "api"},
+	})
+	a.NoError(err)
+
+	entry := WithMessageOptions(newEntry(nil, ""), map[string]string{"source": "worker"})
+	entry.Level = logrus.ErrorLevel
+	entry.Message = entryMessage
+	a.NoError(hook.Fire(entry))
+	msg := receiveMessage(t, messages)
+	a.Equal(map[string]interface{}{"datacenter": "eu-west", "source": "worker"}, msg.Options)
+	a.NotContains(msg.Record, MessageOptionsField)
+	a.Equal(entryMessage, msg.Record[MessageField])
+
+	// the plain message is sent without the options.
+	hook.conf.MessageOptions = nil
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.Nil(receiveMessage(t, messages).Options)
+}
+
+func TestOptionMessageChunk(t *testing.T) {
+	a := assert.New(t)
+
+	m := &optionMessage{
+		tag:     fieldTag,
+		record:  map[string]interface{}{"value": fieldValue},
+		options: map[string]string{"chunk": "user", "datacenter": "eu-west"},
+	}
+	chunk, err := m.Chunk()
+	a.NoError(err)
+	a.NotEmpty(chunk)
+
+	var buf bytes.Buffer
+	a.NoError(msgp.Encode(&buf, m))
+	msg, err := decodeMessage(msgp.NewReader(&buf))
+	a.NoError(err)
+	a.Equal(fieldTag, msg.Tag)
+	a.Equal(map[string]interface{}{"chunk": chunk, "datacenter": "eu-west"}, msg.Options)
+}
+
+func TestMergeOptions(t *testing.T) {
+	a := assert.New(t)
+
+	base := map[string]string{"a": "1", "b": "2"}
+	a.Equal(base, mergeOptions(base, nil))
+	a.Equal(base, mergeOptions(nil, base))
+	a.Equal(map[string]string{"a": "1", "b": "3"}, mergeOptions(base, map[string]string{"b": "3"}))
+	a.Equal("2", base["b"])
+}
@@ -0,0 +1,59 @@
+package logrus_fluent
+
+import (
+	"encoding/json"
+)
+
+// mirror writes the records of the event into Config.MirrorOutputs as the JSON lines of Fallback,
+// and sends them with Config.MirrorSenders. It's called by deliver, so the records are mirrored
+// by the worker in the async mode. The failures are ignored, as the mirrors must not affect the send to fluentd.
+func (hook *FluentHook) mirror(ev *event) {
+	if len(hook.conf.MirrorOutputs) == 0 && len(hook.conf.MirrorSenders) == 0 {
+		return
+	}
+	hook.mirrorMu.Lock()
+	defer hook.mirrorMu.Unlock()
+	for _, e := range ev.events() {
+		if !e.mirror {
+			continue
+		}
+		if len(hook.conf.MirrorOutputs) > 0 {
+			b, err := json.Marshal(fallbackRecord{
+				Tag:    e.tag,
+				Time:   e.time,
+				Record: e.record,
+			})
+			if err == nil {
+				b = append(b, '\n')
+				for _, w := range hook.conf.MirrorOutputs {
+					w.Write(b)
+				}
+			}
+		}
+		for _, s := range hook.conf.MirrorSenders {
+			s.SendMessage(e.tag, e.record)
+		}
+	}
+}
+
+// connectMirrors connects Config.MirrorSenders, and disconnects them on failure.
+func connectMirrors(senders []FluentSender) error {
+	for i, s := range senders {
+		if err := s.Connect(); err != nil {
+			disconnectMirrors(senders[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+// disconnectMirrors disconnects Config.MirrorSenders.
+func disconnectMirrors(senders []FluentSender) error {
+	var err error
+	for _, s := range senders {
+		if e := s.Disconnect(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package logrus_fluent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
+)
+
+func TestMirror(t *testing.T) {
+	a := assert.New(t)
+
+	var out bytes.Buffer
+	sender := testutil.NewMockSender()
+	mirror := testutil.NewMockSender()
+	hook, err := NewWithConfig(Config{
+		Sender:        sender,
+		DefaultTag:    staticTag,
+		MirrorOutputs: []io.Writer{&out},
+		MirrorSenders: []FluentSender{mirror},
+	})
+	a.NoError(err)
+	a.True(mirror.Connected())
+
+	a.NoError(hook.Fire(newEntry(logrus.Fields{"value": fieldValue}, entryMessage)))
+	var line fallbackRecord
+	a.NoError(json.Unmarshal(out.Bytes(), &line))
+	a.Equal(staticTag, line.Tag)
+	a.Equal(fieldValue, line.Record.(map[string]interface{})["value"])
+	if messages := mirror.Messages(); a.Len(messages, 1) {
+		a.Equal(sender.Messages()[0], messages[0])
+	}
+
+	// the failure of the mirror doesn't affect the send.
+	mirror.SetError(errors.New("mirror error"))
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.Len(sender.Messages(), 2)
+
+	a.NoError(hook.Close())
+	a.False(mirror.Connected())
+}
+
+func TestMirrorAsync(t *testing.T) {
+	a := assert.New(t)
+
+	sender := testutil.NewMockSender()
+	mirror := &blockingSender{release: make(chan struct{})}
+	hook, err := NewWithConfig(Config{
+		Sender:          sender,
+		DefaultTag:      staticTag,
+		AsyncBufferSize: 16,
+		MirrorSenders:   []FluentSender{mirror},
+	})
+	a.NoError(err)
+
+	// the stuck mirror blocks the worker, not Fire.
+	fired := make(chan struct{})
+	go func() {
+		defer close(fired)
+		for i := 0; i < 3; i++ {
+			hook.Fire(newEntry(nil, entryMessage))
+		}
+	}()
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("Fire is blocked by the mirror")
+	}
+	a.Empty(sender.Messages())
+
+	close(mirror.release)
+	a.NoError(hook.Flush(context.Background()))
+	a.Len(sender.Messages(), 3)
+	a.NoError(hook.Close())
+}
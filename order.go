@@ -0,0 +1,70 @@
+package logrus_fluent
+
+import (
+	"sort"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// sortedRecord is the record encoded in msgpack with the keys in sorted order, see Config.SortFields.
+// The nested maps in the record are sorted too.
+type sortedRecord map[string]interface{}
+
+var (
+	_ msgp.Encodable = sortedRecord(nil)
+	_ msgp.Marshaler = sortedRecord(nil)
+)
+
+// EncodeMsg writes the map with the sorted keys.
+func (r sortedRecord) EncodeMsg(w *msgp.Writer) error {
+	if err := w.WriteMapHeader(uint32(len(r))); err != nil {
+		return err
+	}
+	for _, k := range r.keys() {
+		if err := w.WriteString(k); err != nil {
+			return err
+		}
+		if err := w.WriteIntf(sortRecord(r[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalMsg appends the map with the sorted keys.
+func (r sortedRecord) MarshalMsg(b []byte) ([]byte, error) {
+	b = msgp.AppendMapHeader(b, uint32(len(r)))
+	for _, k := range r.keys() {
+		b = msgp.AppendString(b, k)
+		var err error
+		if b, err = msgp.AppendIntf(b, sortRecord(r[k])); err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+func (r sortedRecord) keys() []string {
+	keys := make([]string, 0, len(r))
+	for k := range r {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortRecord returns the value whose maps are encoded with the sorted keys.
+func sortRecord(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return sortedRecord(v)
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, e := range v {
+			result[i] = sortRecord(e)
+		}
+		return result
+	default:
+		return v
+	}
+}
@@ -0,0 +1,107 @@
+package logrus_fluent
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/fluent-forward-go/fluent/protocol"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tinylib/msgp/msgp"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// captureSender keeps the encoded messages.
+type captureSender struct {
+	buf bytes.Buffer
+}
+
+func (s *captureSender) Connect() error    { return nil }
+func (s *captureSender) Disconnect() error { return nil }
+func (s *captureSender) SendMessage(tag string, record interface{}) error {
+	return s.Send(protocol.NewMessage(tag, record))
+}
+func (s *captureSender) Send(msg protocol.ChunkEncoder) error {
+	return msgp.Encode(&s.buf, msg)
+}
+
+func TestSortedRecord(t *testing.T) {
+	a := assert.New(t)
+
+	record := map[string]interface{}{
+		"b": 1,
+		"a": map[string]interface{}{"z": true, "y": []interface{}{map[string]interface{}{"d": 1, "c": 2}}},
+		"c": "value",
+	}
+	var buf bytes.Buffer
+	a.NoError(msgp.Encode(&buf, sortedRecord(record)))
+	b, err := sortedRecord(record).MarshalMsg(nil)
+	a.NoError(err)
+	a.Equal(buf.Bytes(), b)
+
+	expected := msgp.AppendMapHeader(nil, 3)
+	expected = msgp.AppendString(expected, "a")
+	expected = msgp.AppendMapHeader(expected, 2)
+	expected = msgp.AppendString(expected, "y")
+	expected = msgp.AppendArrayHeader(expected, 1)
+	expected = msgp.AppendMapHeader(expected, 2)
+	expected = msgp.AppendString(expected, "c")
+	expected = msgp.AppendInt(expected, 2)
+	expected = msgp.AppendString(expected, "d")
+	expected = msgp.AppendInt(expected, 1)
+	expected = msgp.AppendString(expected, "z")
+	expected = msgp.AppendBool(expected, true)
+	expected = msgp.AppendString(expected, "b")
+	expected = msgp.AppendInt(expected, 1)
+	expected = msgp.AppendString(expected, "c")
+	expected = msgp.AppendString(expected, "value")
+	a.Equal(expected, b)
+}
+
+func TestSortFieldsGolden(t *testing.T) {
+	a := assert.New(t)
+
+	sender := &captureSender{}
+	hook, err := NewWithConfig(Config{
+		Sender:       sender,
+		DefaultTag:   staticTag,
+		UseEventTime: true,
+		SortFields:   true,
+	})
+	a.NoError(err)
+
+	entry := newEntry(logrus.Fields{
+		"user":   "alice",
+		"id":     12345,
+		"http":   map[string]interface{}{"status": 404, "method": "GET", "path": "/items"},
+		"tags":   []string{"b", "a"},
+		"ok":     false,
+		"amount": 1.5,
+	}, entryMessage)
+	entry.Time = time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	a.NoError(hook.Fire(entry))
+
+	got := hex.EncodeToString(sender.buf.Bytes())
+	path := filepath.Join("testdata", "sorted_message.golden")
+	if *update {
+		a.NoError(os.MkdirAll("testdata", 0o755))
+		a.NoError(os.WriteFile(path, []byte(got+"\n"), 0o644))
+	}
+	want, err := os.ReadFile(path)
+	a.NoError(err)
+	a.Equal(strings.TrimSpace(string(want)), got)
+
+	// the payload is stable over the map iteration order.
+	for i := 0; i < 10; i++ {
+		sender.buf.Reset()
+		a.NoError(hook.Fire(entry))
+		a.Equal(got, hex.EncodeToString(sender.buf.Bytes()))
+	}
+}
@@ -0,0 +1,28 @@
+package logrus_fluent
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// HostnameField is the field name of the hostname of Config.IncludeHostname.
+	HostnameField = "hostname"
+	// PIDField is the field name of the process ID of Config.IncludeProcessInfo.
+	PIDField = "pid"
+)
+
+// processFields returns the hostname and the process ID enabled in the config.
+func processFields(conf Config) logrus.Fields {
+	fields := logrus.Fields{}
+	if conf.IncludeHostname {
+		if name, err := os.Hostname(); err == nil {
+			fields[HostnameField] = name
+		}
+	}
+	if conf.IncludeProcessInfo {
+		fields[PIDField] = os.Getpid()
+	}
+	return fields
+}
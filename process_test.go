@@ -0,0 +1,77 @@
+package logrus_fluent
+
+import (
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
+)
+
+func TestProcessFields(t *testing.T) {
+	a := assert.New(t)
+
+	a.Empty(processFields(Config{}))
+
+	hostname, err := os.Hostname()
+	a.NoError(err)
+	a.Equal(logrus.Fields{
+		HostnameField: hostname,
+		PIDField:      os.Getpid(),
+	}, processFields(Config{IncludeHostname: true, IncludeProcessInfo: true}))
+}
+
+func TestStaticFields(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:               testHOST,
+		Port:               port,
+		IncludeProcessInfo: true,
+		StaticFields:       map[string]interface{}{"service": "api", PIDField: "overridden"},
+	})
+	a.NoError(err)
+
+	a.NoError(hook.Fire(newEntry(logrus.Fields{"service": "worker"}, entryMessage)))
+	msg := receiveMessage(t, messages)
+	a.Equal("worker", msg.Record["service"])
+	a.Equal("overridden", msg.Record[PIDField])
+	a.NotContains(msg.Record, HostnameField)
+}
+
+func TestLevelAndTagFields(t *testing.T) {
+	a := assert.New(t)
+
+	sender := testutil.NewMockSender()
+	hook, err := NewWithConfig(Config{
+		Sender:      sender,
+		LevelFields: map[logrus.Level]logrus.Fields{logrus.ErrorLevel: {"alert": true, "service": "overridden"}},
+		TagFields:   map[string]logrus.Fields{"app.prod": {"env": "production"}},
+	})
+	a.NoError(err)
+	var customized logrus.Fields
+	hook.AddCustomizer(func(entry *logrus.Entry, data logrus.Fields) {
+		customized = logrus.Fields{"alert": data["alert"]}
+	})
+
+	a.NoError(hook.Fire(newEntry(logrus.Fields{"service": "api", TagField: "app.prod"}, entryMessage)))
+	a.Equal(true, customized["alert"])
+
+	entry := newEntry(logrus.Fields{TagField: "app.dev"}, entryMessage)
+	entry.Level = logrus.InfoLevel
+	a.NoError(hook.Fire(entry))
+
+	if messages := sender.Messages(); a.Len(messages, 2) {
+		record := messages[0].Record.(map[string]interface{})
+		a.Equal(true, record["alert"])
+		a.Equal("api", record["service"])
+		a.Equal("production", record["env"])
+
+		record = messages[1].Record.(map[string]interface{})
+		a.NotContains(record, "alert")
+		a.NotContains(record, "env")
+	}
+}
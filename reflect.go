@@ -1,59 +1,377 @@
 package logrus_fluent
 
 import (
+	"bytes"
+	"encoding"
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
-// ConvertToValue make map data from struct and tags
+// TruncatedField is set to true in the record when any of RecordBudget is exhausted.
+const TruncatedField = "_truncated"
+
+// RecordBudget limits the record made by the converter. (0 is unlimited)
+// The converter stops the walk once any budget is exhausted,
+// and sets TruncatedField in the record.
+type RecordBudget struct {
+	MaxDepth    int // max depth of the nested maps, slices and structs.
+	MaxArrayLen int // max length of each slice.
+	MaxFields   int // max number of the map keys and struct fields in the whole record.
+	MaxBytes    int // max estimated size of the keys and the scalar values in bytes.
+
+	// StringifyDeep keeps the value deeper than MaxDepth as the JSON string
+	// instead of dropping it. It doesn't set TruncatedField.
+	StringifyDeep bool
+}
+
+func (b RecordBudget) isZero() bool {
+	return b == RecordBudget{}
+}
+
+// converter makes map data from any value with the budget.
+type converter struct {
+	tagName    string
+	budget     RecordBudget
+	marshalers bool // json.Marshaler, encoding.TextMarshaler and fmt.Stringer are used.
+
+	fields    int
+	bytes     int
+	truncated bool // any part of the record is cut.
+	stopped   bool // no more value can be added into the record.
+}
+
+// ConvertToValue make map data from struct and tags.
+// The value implementing json.Marshaler, encoding.TextMarshaler or fmt.Stringer
+// is converted by it, in this priority order.
 func ConvertToValue(p interface{}, tagName string) interface{} {
+	c := &converter{tagName: tagName, marshalers: true}
+	return c.convert(p, 1)
+}
+
+// convertRecord makes the record from the log fields within the budget.
+// The marshalers of the values are used unless noMarshalers, see ConvertToValue.
+func convertRecord(p interface{}, tagName string, budget RecordBudget, noMarshalers bool) interface{} {
+	c := &converter{
+		tagName:    tagName,
+		budget:     budget,
+		marshalers: !noMarshalers,
+	}
+	result := c.convert(p, 1)
+	if m, ok := result.(map[string]interface{}); ok && c.truncated {
+		m[TruncatedField] = true
+	}
+	return result
+}
+
+// DefaultFlattenSeparator joins the keys of Config.FlattenFields.
+const DefaultFlattenSeparator = "."
+
+// flattenRecord joins the keys of the nested maps with the separator. (default: DefaultFlattenSeparator)
+// e.g. {"http": {"status": 200}} => {"http.status": 200}
+// The slices and the empty maps are kept as they are.
+// When the keys collide, the value of the last key in sorted order wins.
+func flattenRecord(record interface{}, sep string) interface{} {
+	m, ok := record.(map[string]interface{})
+	if !ok {
+		return record
+	}
+	if sep == "" {
+		sep = DefaultFlattenSeparator
+	}
+	result := make(map[string]interface{}, len(m))
+	flattenInto(result, "", m, sep)
+	return result
+}
+
+func flattenInto(result map[string]interface{}, prefix string, m map[string]interface{}, sep string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		key := k
+		if prefix != "" {
+			key = prefix + sep + k
+		}
+		if child, ok := m[k].(map[string]interface{}); ok && len(child) > 0 {
+			flattenInto(result, key, child, sep)
+			continue
+		}
+		result[key] = m[k]
+	}
+}
+
+// convert converts the value in the depth.
+// The depth is the number of the nested maps, slices and structs including the value itself.
+func (c *converter) convert(p interface{}, depth int) interface{} {
+	// fast path without the reflection for the common values of the log fields.
+	switch v := p.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		return c.convertFromStringMap(v, depth)
+	case logrus.Fields:
+		return c.convertFromStringMap(v, depth)
+	}
+	if isPrimitive(p) {
+		return c.scalar(p)
+	}
+
 	rv := toValue(p)
+	if rv.IsValid() {
+		if v, ok := c.convertSpecial(p); ok {
+			return c.scalar(v)
+		}
+	}
+
 	switch rv.Kind() {
 	case reflect.Struct:
-		if err, ok := p.(error); ok {
-			return err.Error()
-		}
-		return convertFromStruct(rv.Interface(), tagName)
+		return c.convertFromStructDeep(make(map[string]interface{}, rv.NumField()), rv.Type(), rv, depth)
 	case reflect.Map:
-		return convertFromMap(rv, tagName)
+		return c.convertFromMap(rv, depth)
 	case reflect.Slice:
-		return convertFromSlice(rv, tagName)
+		return c.convertFromSlice(rv, depth)
 	case reflect.Chan:
 		return nil
 	case reflect.Invalid:
 		return nil
 	default:
-		return rv.Interface()
+		return c.scalar(rv.Interface())
+	}
+}
+
+// convertSpecial converts time.Time into RFC3339Nano string, and error into its message.
+// The marshalers are used next if enabled, and the value failed to marshal is converted as usual.
+func (c *converter) convertSpecial(p interface{}) (interface{}, bool) {
+	switch v := p.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano), true
+	case *time.Time:
+		return v.Format(time.RFC3339Nano), true
+	case error:
+		return v.Error(), true
+	}
+	if !c.marshalers {
+		return nil, false
+	}
+
+	switch v := p.(type) {
+	case json.Marshaler:
+		if b, err := v.MarshalJSON(); err == nil {
+			if result, err := decodeJSON(b); err == nil {
+				return result, true
+			}
+		}
+	case encoding.TextMarshaler:
+		if b, err := v.MarshalText(); err == nil {
+			return string(b), true
+		}
+	case fmt.Stringer:
+		return v.String(), true
+	}
+	return nil, false
+}
+
+// decodeJSON decodes the JSON from json.Marshaler.
+// The numbers are decoded into int64 when possible, otherwise float64.
+func decodeJSON(b []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	return normalizeJSON(v), nil
+}
+
+func normalizeJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = normalizeJSON(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = normalizeJSON(e)
+		}
+	}
+	return v
+}
+
+// convertChild converts the child value of the map, slice or struct.
+// It returns false when the value must not be added into the record.
+// The partially converted map or slice is kept even if the walk is stopped.
+func (c *converter) convertChild(p interface{}, depth int) (interface{}, bool) {
+	if isPrimitive(p) {
+		return c.scalar(p), !c.stopped
+	}
+	if toValue(p).IsValid() {
+		if v, ok := c.convertSpecial(p); ok {
+			return c.scalar(v), !c.stopped
+		}
+	}
+	container := c.isContainer(p)
+	if c.budget.MaxDepth > 0 && depth > c.budget.MaxDepth && container {
+		if c.budget.StringifyDeep {
+			return c.scalar(stringify(p)), !c.stopped
+		}
+		c.truncated = true
+		return nil, false
+	}
+
+	v := c.convert(p, depth)
+	return v, container || !c.stopped
+}
+
+// stringify returns the JSON of the value, or the formatted value when it can't be marshaled.
+func stringify(p interface{}) string {
+	if b, err := json.Marshal(p); err == nil {
+		return string(b)
+	}
+	return fmt.Sprintf("%+v", p)
+}
+
+// addField counts the field and checks it can be added into the record.
+func (c *converter) addField(name string) bool {
+	if c.budget.isZero() {
+		return true
+	}
+	if c.stopped {
+		return false
+	}
+	c.fields++
+	c.bytes += len(name)
+	if (c.budget.MaxFields > 0 && c.fields > c.budget.MaxFields) ||
+		(c.budget.MaxBytes > 0 && c.bytes > c.budget.MaxBytes) {
+		c.stop()
+		return false
+	}
+	return true
+}
+
+// scalar counts the size of the scalar value.
+func (c *converter) scalar(v interface{}) interface{} {
+	if c.budget.MaxBytes <= 0 {
+		return v
+	}
+	switch vv := v.(type) {
+	case string:
+		c.bytes += len(vv)
+	case []byte:
+		c.bytes += len(vv)
+	default:
+		c.bytes += 8
+	}
+	if c.bytes > c.budget.MaxBytes {
+		c.stop()
 	}
+	return v
+}
+
+// stop stops the walk as the budget is exhausted.
+func (c *converter) stop() {
+	c.truncated = true
+	c.stopped = true
 }
 
-func convertFromMap(rv reflect.Value, tagName string) interface{} {
+func (c *converter) convertFromMap(rv reflect.Value, depth int) interface{} {
 	result := make(map[string]interface{})
-	for _, key := range rv.MapKeys() {
+	keys := rv.MapKeys()
+	if !c.budget.isZero() {
+		// sort keys to decide the kept fields deterministically.
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+	}
+
+	for _, key := range keys {
+		name := fmt.Sprint(key.Interface())
+		if !c.addField(name) {
+			break
+		}
 		kv := rv.MapIndex(key)
-		result[fmt.Sprint(key.Interface())] = ConvertToValue(kv.Interface(), tagName)
+		v, ok := c.convertChild(kv.Interface(), depth+1)
+		if ok {
+			result[name] = v
+		}
+		if c.stopped {
+			break
+		}
 	}
 	return result
 }
 
-func convertFromSlice(rv reflect.Value, tagName string) interface{} {
-	var result []interface{}
-	for i, max := 0, rv.Len(); i < max; i++ {
-		result = append(result, ConvertToValue(rv.Index(i).Interface(), tagName))
+// convertFromStringMap is convertFromMap of map[string]interface{}, which avoids the reflection.
+func (c *converter) convertFromStringMap(m map[string]interface{}, depth int) interface{} {
+	result := make(map[string]interface{}, len(m))
+	if c.budget.isZero() {
+		for k, v := range m {
+			if vv, ok := c.convertChild(v, depth+1); ok {
+				result[k] = vv
+			}
+		}
+		return result
+	}
+
+	// sort keys to decide the kept fields deterministically.
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !c.addField(k) {
+			break
+		}
+		if v, ok := c.convertChild(m[k], depth+1); ok {
+			result[k] = v
+		}
+		if c.stopped {
+			break
+		}
 	}
 	return result
 }
 
-// convertFromStruct converts struct to value
-// see: https://github.com/fatih/structs/
-func convertFromStruct(p interface{}, tagName string) interface{} {
-	result := make(map[string]interface{})
-	return convertFromStructDeep(result, tagName, toType(p), toValue(p))
+func (c *converter) convertFromSlice(rv reflect.Value, depth int) interface{} {
+	var result []interface{}
+	max := rv.Len()
+	if c.budget.MaxArrayLen > 0 && max > c.budget.MaxArrayLen {
+		max = c.budget.MaxArrayLen
+		c.truncated = true
+	}
+
+	for i := 0; i < max; i++ {
+		v, ok := c.convertChild(rv.Index(i).Interface(), depth+1)
+		if ok {
+			result = append(result, v)
+		}
+		if c.stopped {
+			break
+		}
+	}
+	return result
 }
 
-func convertFromStructDeep(result map[string]interface{}, tagName string, t reflect.Type, values reflect.Value) interface{} {
-	for i, max := 0, t.NumField(); i < max; i++ {
+// convertFromStructDeep converts struct to value
+// see: https://github.com/fatih/structs/
+func (c *converter) convertFromStructDeep(result map[string]interface{}, t reflect.Type, values reflect.Value, depth int) interface{} {
+	tagName := c.tagName
+	for i, max := 0, t.NumField(); i < max && !c.stopped; i++ {
 		f := t.Field(i)
 		if f.PkgPath != "" && !f.Anonymous {
 			continue
@@ -73,7 +391,7 @@ func convertFromStructDeep(result map[string]interface{}, tagName string, t refl
 			}
 
 			if vv.Kind() == reflect.Struct {
-				convertFromStructDeep(result, tagName, tt, vv)
+				c.convertFromStructDeep(result, tt, vv, depth)
 			}
 			continue
 		}
@@ -87,15 +405,118 @@ func convertFromStructDeep(result map[string]interface{}, tagName string, t refl
 			continue
 		}
 		v := values.Field(i)
-		if opts.Has("omitempty") && isZero(v) {
+		if opts.Has("omitempty") && isEmpty(v) {
 			continue // skip zero-value when omitempty option exists in tag
 		}
-		name := getNameFromTag(f, tagName)
-		result[name] = ConvertToValue(v.Interface(), TagName)
+		if opts.Has("inline") && c.inline(result, v, depth) {
+			continue // promote the fields to the parent when inline option exists in tag
+		}
+		name := tag
+		if name == "" {
+			name = f.Name
+		}
+		if !c.addField(name) {
+			break
+		}
+		if opts.Has("mask") {
+			result[name] = MaskValue // hide the actual value when mask option exists in tag
+			continue
+		}
+		if opts.Has("string") {
+			result[name] = c.stringValue(v.Interface()) // force the string when string option exists in tag
+			continue
+		}
+		vv, ok := c.convertChild(v.Interface(), depth+1)
+		if ok {
+			result[name] = vv
+		}
+		if c.stopped {
+			break
+		}
 	}
 	return result
 }
 
+// inline converts the struct or map field into the parent map.
+// It returns false when the field isn't struct nor map, to add it as the normal field.
+func (c *converter) inline(result map[string]interface{}, v reflect.Value, depth int) bool {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return true // nothing to promote
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if _, ok := c.convertSpecial(v.Interface()); ok {
+			return false
+		}
+		c.convertFromStructDeep(result, v.Type(), v, depth)
+		return true
+	case reflect.Map:
+		m, ok := c.convertChild(v.Interface(), depth)
+		if !ok {
+			return true
+		}
+		if mm, ok := m.(map[string]interface{}); ok {
+			for k, vv := range mm {
+				result[k] = vv
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// stringValue returns the value as string for the string option of the struct tag.
+// The container is encoded into JSON.
+func (c *converter) stringValue(p interface{}) string {
+	if special, ok := c.convertSpecial(p); ok {
+		p = special
+	}
+	rv := toValue(p)
+	switch {
+	case !rv.IsValid():
+		return ""
+	case c.isContainer(p):
+		return stringify(p)
+	case rv.Kind() == reflect.String:
+		return rv.String()
+	default:
+		return fmt.Sprint(rv.Interface())
+	}
+}
+
+// isContainer checks the value is converted into map or slice.
+func (c *converter) isContainer(p interface{}) bool {
+	rv := toValue(p)
+	if rv.IsValid() {
+		if _, ok := c.convertSpecial(p); ok {
+			return false
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice:
+		return true
+	default:
+		return false
+	}
+}
+
+// isPrimitive reports whether the value is the builtin scalar, which is kept as it is.
+func isPrimitive(p interface{}) bool {
+	switch p.(type) {
+	case string, bool,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return true
+	default:
+		return false
+	}
+}
+
 // toValue converts any value to reflect.Value
 func toValue(p interface{}) reflect.Value {
 	v := reflect.ValueOf(p)
@@ -105,13 +526,15 @@ func toValue(p interface{}) reflect.Value {
 	return v
 }
 
-// toType converts any value to reflect.Type
-func toType(p interface{}) reflect.Type {
-	t := reflect.ValueOf(p).Type()
-	if t.Kind() == reflect.Ptr {
-		t = t.Elem()
+// isEmpty checks the value is omitted by omitempty option or not.
+// Like encoding/json, empty maps and slices are omitted in addition to zero-values.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice:
+		return v.Len() == 0
+	default:
+		return isZero(v)
 	}
-	return t
 }
 
 // isZero checks the value is zero-value or not
@@ -121,15 +544,6 @@ func isZero(v reflect.Value) bool {
 	return reflect.DeepEqual(value, zero)
 }
 
-// getNameFromTag return the value in tag or field name in the struct field
-func getNameFromTag(f reflect.StructField, tagName string) string {
-	tag, _ := parseTag(f, tagName)
-	if tag != "" {
-		return tag
-	}
-	return f.Name
-}
-
 // getTagValues returns tag value of the struct field
 func getTagValues(f reflect.StructField, tag string) string {
 	return f.Tag.Get(tag)
@@ -140,18 +554,21 @@ func parseTag(f reflect.StructField, tag string) (string, options) {
 	return splitTags(getTagValues(f, tag))
 }
 
-// splitTags returns the first tag value and rest slice
+// splitTags returns the first tag value and the rest values
 func splitTags(tags string) (string, options) {
-	res := strings.Split(tags, ",")
-	return res[0], res[1:]
+	name, opts, _ := strings.Cut(tags, ",")
+	return name, options(opts)
 }
 
-// TagOptions is wrapper struct for rest tag values
-type options []string
+// options is the rest tag values, kept comma-separated not to allocate the slice for every field.
+type options string
 
 // Has checks the value exists in the rest values or not
 func (t options) Has(tag string) bool {
-	for _, opt := range t {
+	s := string(t)
+	for s != "" {
+		var opt string
+		opt, s, _ = strings.Cut(s, ",")
 		if opt == tag {
 			return true
 		}
@@ -3,8 +3,12 @@ package logrus_fluent
 import (
 	"errors"
 	"testing"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
 )
 
 type eyes int
@@ -39,6 +43,40 @@ func TestConvertToValuError(t *testing.T) {
 	assert.Equal(err.Error(), r["error"])
 }
 
+type codeError string
+
+func (e codeError) Error() string { return "code: " + string(e) }
+
+func TestConvertToValueSpecial(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	data := map[string]interface{}{
+		"time":    ts,
+		"timePtr": &ts,
+		"error":   codeError("E1"),
+		"struct": struct {
+			CreatedAt time.Time
+			Err       error
+		}{ts, codeError("E2")},
+	}
+
+	result := ConvertToValue(data, TagName)
+	assert.Equal(map[string]interface{}{
+		"time":    "2020-01-02T03:04:05.000000006Z",
+		"timePtr": "2020-01-02T03:04:05.000000006Z",
+		"error":   "code: E1",
+		"struct": map[string]interface{}{
+			"CreatedAt": "2020-01-02T03:04:05.000000006Z",
+			"Err":       "code: E2",
+		},
+	}, result)
+
+	// time.Time is not a container for MaxDepth.
+	result = convertRecord(map[string]interface{}{"time": ts}, TagName, RecordBudget{MaxDepth: 1}, false)
+	assert.Equal(map[string]interface{}{"time": "2020-01-02T03:04:05.000000006Z"}, result)
+}
+
 func TestConvertToValueStruct(t *testing.T) {
 	assert := assert.New(t)
 
@@ -92,3 +130,303 @@ func TestConvertToValueNil(t *testing.T) {
 	result = ConvertToValue(ptr, TagName)
 	assert.Equal(nil, result)
 }
+
+func TestConvertToValueOmitEmpty(t *testing.T) {
+	assert := assert.New(t)
+
+	type optional struct {
+		Ptr       *Creature              `fluent:"ptr,omitempty"`
+		Slice     []string               `fluent:"slice,omitempty"`
+		Array     [0]int                 `fluent:"array,omitempty"`
+		Map       map[string]interface{} `fluent:"map,omitempty"`
+		Interface interface{}            `fluent:"interface,omitempty"`
+		String    string                 `fluent:"string,omitempty"`
+		Int       int                    `fluent:"int,omitempty"`
+	}
+
+	tests := []struct {
+		value    optional
+		expected map[string]interface{}
+	}{
+		{optional{}, map[string]interface{}{}},
+		{optional{Slice: []string{}, Map: map[string]interface{}{}}, map[string]interface{}{}},
+		{optional{Ptr: &Creature{}}, map[string]interface{}{"ptr": ConvertToValue(&Creature{}, TagName)}},
+		{optional{Slice: []string{""}}, map[string]interface{}{"slice": []interface{}{""}}},
+		{optional{Map: map[string]interface{}{"k": nil}}, map[string]interface{}{"map": map[string]interface{}{"k": nil}}},
+		{optional{Interface: 0}, map[string]interface{}{"interface": 0}},
+		{optional{String: "s", Int: 1}, map[string]interface{}{"string": "s", "int": 1}},
+	}
+	for _, tt := range tests {
+		assert.Equal(tt.expected, ConvertToValue(tt.value, TagName))
+	}
+}
+
+type account struct {
+	User     string `fluent:"user"`
+	Password string `fluent:",mask"`
+	SSN      string `fluent:"ssn,mask,omitempty"`
+	Token    string `fluent:"-,mask"`
+}
+
+func TestConvertToValueMask(t *testing.T) {
+	tests := []struct {
+		value    account
+		expected map[string]interface{}
+	}{
+		{
+			account{User: "alice", Password: "secret", SSN: "123-45-6789", Token: "xyz"},
+			map[string]interface{}{"user": "alice", "Password": MaskValue, "ssn": MaskValue},
+		},
+		{
+			account{User: "bob"},
+			map[string]interface{}{"user": "bob", "Password": MaskValue},
+		},
+	}
+
+	for _, tt := range tests {
+		result := ConvertToValue(tt.value, TagName)
+		assert.Equal(t, tt.expected, result)
+	}
+}
+
+type request struct {
+	ID      int64             `fluent:"id,string"`
+	Tags    []string          `fluent:"tags,string"`
+	Account account           `fluent:",inline"`
+	Headers map[string]string `fluent:",inline"`
+	Ptr     *account          `fluent:",inline"`
+	Name    string            `fluent:",inline"`
+}
+
+func TestConvertToValueTagOptions(t *testing.T) {
+	a := assert.New(t)
+
+	result := ConvertToValue(request{
+		ID:      42,
+		Tags:    []string{"a", "b"},
+		Account: account{User: "alice"},
+		Headers: map[string]string{"host": "example.com"},
+		Name:    "name",
+	}, TagName)
+	a.Equal(map[string]interface{}{
+		"id":       "42",
+		"tags":     `["a","b"]`,
+		"user":     "alice",
+		"Password": MaskValue,
+		"host":     "example.com",
+		"Name":     "name", // not struct nor map
+	}, result)
+}
+
+func TestConvertRecordBudget(t *testing.T) {
+	data := map[string]interface{}{
+		"a": "12345",
+		"b": []int{1, 2, 3},
+		"c": map[string]interface{}{
+			"d": map[string]interface{}{"e": 1},
+			"f": 2,
+		},
+	}
+
+	tests := []struct {
+		name     string
+		budget   RecordBudget
+		expected map[string]interface{}
+	}{
+		{
+			"no budget", RecordBudget{},
+			map[string]interface{}{
+				"a": "12345",
+				"b": []interface{}{1, 2, 3},
+				"c": map[string]interface{}{
+					"d": map[string]interface{}{"e": 1},
+					"f": 2,
+				},
+			},
+		},
+		{
+			"enough budget", RecordBudget{MaxDepth: 3, MaxArrayLen: 3, MaxFields: 6, MaxBytes: 100},
+			map[string]interface{}{
+				"a": "12345",
+				"b": []interface{}{1, 2, 3},
+				"c": map[string]interface{}{
+					"d": map[string]interface{}{"e": 1},
+					"f": 2,
+				},
+			},
+		},
+		{
+			"depth", RecordBudget{MaxDepth: 2},
+			map[string]interface{}{
+				"a": "12345",
+				"b": []interface{}{1, 2, 3},
+				"c": map[string]interface{}{
+					"f": 2,
+				},
+				TruncatedField: true,
+			},
+		},
+		{
+			"depth stringified", RecordBudget{MaxDepth: 2, StringifyDeep: true},
+			map[string]interface{}{
+				"a": "12345",
+				"b": []interface{}{1, 2, 3},
+				"c": map[string]interface{}{
+					"d": `{"e":1}`,
+					"f": 2,
+				},
+			},
+		},
+		{
+			"array length", RecordBudget{MaxArrayLen: 2},
+			map[string]interface{}{
+				"a": "12345",
+				"b": []interface{}{1, 2},
+				"c": map[string]interface{}{
+					"d": map[string]interface{}{"e": 1},
+					"f": 2,
+				},
+				TruncatedField: true,
+			},
+		},
+		{
+			"fields", RecordBudget{MaxFields: 4},
+			map[string]interface{}{
+				"a": "12345",
+				"b": []interface{}{1, 2, 3},
+				"c": map[string]interface{}{
+					"d": map[string]interface{}{},
+				},
+				TruncatedField: true,
+			},
+		},
+		{
+			"bytes", RecordBudget{MaxBytes: 20},
+			map[string]interface{}{
+				"a":            "12345",
+				"b":            []interface{}{1},
+				TruncatedField: true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		result := convertRecord(data, TagName, tt.budget, false)
+		assert.Equal(t, tt.expected, result, tt.name)
+	}
+}
+
+func TestFlattenRecord(t *testing.T) {
+	a := assert.New(t)
+
+	record := map[string]interface{}{
+		"a": 1,
+		"b": map[string]interface{}{
+			"c": map[string]interface{}{"d": 2},
+			"e": []interface{}{map[string]interface{}{"f": 3}},
+			"g": map[string]interface{}{},
+		},
+	}
+	a.Equal(map[string]interface{}{
+		"a":     1,
+		"b.c.d": 2,
+		"b.e":   []interface{}{map[string]interface{}{"f": 3}},
+		"b.g":   map[string]interface{}{},
+	}, flattenRecord(record, ""))
+	a.Equal(map[string]interface{}{"b_c": 1}, flattenRecord(map[string]interface{}{"b": map[string]interface{}{"c": 1}}, "_"))
+	a.Equal("value", flattenRecord("value", ""))
+
+	// the last key in sorted order wins.
+	a.Equal(map[string]interface{}{"b.c": 2}, flattenRecord(map[string]interface{}{
+		"b":   map[string]interface{}{"c": 1},
+		"b.c": 2,
+	}, ""))
+}
+
+func TestFlattenFields(t *testing.T) {
+	a := assert.New(t)
+
+	type request struct {
+		Method string `fluent:"method"`
+		Status int    `fluent:"status"`
+	}
+	sender := testutil.NewMockSender()
+	hook, err := NewWithConfig(Config{
+		Sender:        sender,
+		DefaultTag:    staticTag,
+		FlattenFields: true,
+	})
+	a.NoError(err)
+	a.NoError(hook.Fire(newEntry(logrus.Fields{"http": request{Method: "GET", Status: 200}}, entryMessage)))
+	if messages := sender.Messages(); a.Len(messages, 1) {
+		record := messages[0].Record.(map[string]interface{})
+		a.Equal("GET", record["http.method"])
+		a.Equal(200, record["http.status"])
+		a.NotContains(record, "http")
+	}
+}
+
+type jsonValue struct{ v string }
+
+func (j jsonValue) MarshalJSON() ([]byte, error) {
+	return []byte(`{"value":"` + j.v + `","n":1,"f":1.5}`), nil
+}
+
+func (j jsonValue) String() string { return "string" }
+
+type textValue [2]byte
+
+func (t textValue) MarshalText() ([]byte, error) { return []byte("text"), nil }
+
+func (t textValue) String() string { return "string" }
+
+type stringerValue int
+
+func (s stringerValue) String() string { return "stringer" }
+
+func TestConvertMarshalers(t *testing.T) {
+	a := assert.New(t)
+
+	data := map[string]interface{}{
+		"json":     jsonValue{"a"},
+		"text":     textValue{},
+		"stringer": stringerValue(1),
+		"ptr":      &jsonValue{"b"},
+	}
+	a.Equal(map[string]interface{}{
+		"json":     map[string]interface{}{"value": "a", "n": int64(1), "f": 1.5},
+		"text":     "text",
+		"stringer": "stringer",
+		"ptr":      map[string]interface{}{"value": "b", "n": int64(1), "f": 1.5},
+	}, ConvertToValue(data, TagName))
+
+	result := convertRecord(data, TagName, RecordBudget{}, true).(map[string]interface{})
+	a.Equal(map[string]interface{}{}, result["json"])
+	a.Equal(textValue{}, result["text"])
+	a.Equal(stringerValue(1), result["stringer"])
+}
+
+func BenchmarkConvertToValue(b *testing.B) {
+	fields := map[string]interface{}{
+		"user":    "alice",
+		"id":      12345,
+		"latency": 1.5,
+		"ok":      true,
+		"nested":  map[string]interface{}{"path": "/api/v1/items", "status": 404},
+		"tags":    []string{"a", "b"},
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ConvertToValue(fields, TagName)
+	}
+}
+
+func BenchmarkConvertToValueStruct(b *testing.B) {
+	creature := Creature{animal: &animal{eyes: 2, Fur: true}, Name: "cat", Height: 30, Weight: 4, Alias: "tama"}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ConvertToValue(creature, TagName)
+	}
+}
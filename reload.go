@@ -0,0 +1,151 @@
+package logrus_fluent
+
+import (
+	"time"
+
+	"github.com/IBM/fluent-forward-go/fluent/client"
+	"github.com/sirupsen/logrus"
+)
+
+// Reload applies the config to the running hook without losing the buffered entries,
+// e.g. when the service re-reads its config on SIGHUP. These are replaced:
+//
+//   - the tag: DefaultTag, TagPrefix and DefaultMessageField.
+//   - the levels: LogLevels or MinLevel. logrus reads the levels on AddHook, so add the hook again to apply them.
+//   - the filters: DefaultIgnoreFields, AllowedFields and DefaultFilters.
+//     The changes made by AddIgnore, SetAllowList and AddFilter at runtime are discarded,
+//     so call them again after Reload to keep them.
+//   - the connections: the endpoints (Host, Port, Hosts or SocketPath) and their settings,
+//     e.g. Timeout, WriteTimeout, AckTimeout, PoolSize and TLS. They're kept when the hook has Config.Sender,
+//     including the websocket of TransportWebSocket, whose URL isn't changed.
+//   - SendTimeout.
+//
+// The new endpoints are connected before the swap, and the old connections are closed right after it,
+// so the entries in the async buffer are sent to the new endpoints. The sends in flight on the old
+// connections may fail, and they're retried on the new endpoints when Config.MaxRetries is set.
+// Nothing is changed on error. The other fields, e.g. AsyncBufferSize and BufferPath, need a new hook.
+func (hook *FluentHook) Reload(conf Config) error {
+	hook.closeMu.RLock()
+	defer hook.closeMu.RUnlock()
+	if hook.closed {
+		return ErrClosed
+	}
+	hook.reloadMu.Lock()
+	defer hook.reloadMu.Unlock()
+
+	var endpoints []*endpoint
+	if hook.conf.Sender == nil {
+		var err error
+		if endpoints, err = connectEndpoints(conf); err != nil {
+			return err
+		}
+	}
+
+	hook.applySettings(conf)
+	hook.sendTimeout.Store(int64(conf.SendTimeout))
+	if hook.conf.Sender == nil {
+		hook.swapEndpoints(endpoints, conf.HealthCheckInterval)
+	}
+	return nil
+}
+
+// applySettings sets the tag, the levels and the filters of the config.
+func (hook *FluentHook) applySettings(conf Config) {
+	levels := conf.LogLevels
+	if len(levels) == 0 && conf.MinLevel != logrus.PanicLevel {
+		levels = levelsUpTo(conf.MinLevel)
+	}
+	if len(levels) == 0 {
+		levels = defaultLevels
+	}
+	var tag *string
+	if conf.DefaultTag != "" {
+		t := conf.DefaultTag
+		tag = &t
+	}
+	messageField := conf.DefaultMessageField
+	if messageField == "" {
+		messageField = MessageField
+	}
+
+	hook.confMu.Lock()
+	hook.levels = levels
+	hook.tag = tag
+	hook.tagPrefix = conf.TagPrefix
+	hook.messageField = messageField
+	hook.confMu.Unlock()
+
+	ignoreFields := make(map[string]struct{}, len(conf.DefaultIgnoreFields))
+	for k, v := range conf.DefaultIgnoreFields {
+		ignoreFields[k] = v
+	}
+	filters := make(map[string]func(interface{}) interface{}, len(conf.DefaultFilters))
+	for k, v := range conf.DefaultFilters {
+		filters[k] = v
+	}
+
+	allowFields := newAllowFields(conf.AllowedFields)
+
+	hook.filterMu.Lock()
+	hook.ignoreFields = ignoreFields
+	hook.allowFields = allowFields
+	hook.filters = filters
+	hook.filterMu.Unlock()
+}
+
+// swapEndpoints replaces the endpoints, and closes the old ones after the sends on them.
+// The health check is restarted for the new endpoints.
+func (hook *FluentHook) swapEndpoints(endpoints []*endpoint, healthCheckInterval time.Duration) {
+	fd, pool := poolOf(endpoints)
+
+	// the sends and the health check hold the read lock.
+	hook.endpointMu.Lock()
+	old := hook.endpoints
+	healthCheck := hook.healthCheck
+	hook.Fluent, hook.pool, hook.endpoints = fd, pool, endpoints
+	hook.healthCheck = nil
+	hook.endpointMu.Unlock()
+
+	healthCheck.close()
+	for _, e := range old {
+		e.disconnect()
+	}
+
+	hook.endpointMu.Lock()
+	defer hook.endpointMu.Unlock()
+	if hook.needsHealthCheck(healthCheckInterval) {
+		hook.startHealthCheck(healthCheckInterval)
+	}
+}
+
+// connections returns the current endpoints and the loggers of them.
+func (hook *FluentHook) connections() ([]*endpoint, []*pooledClient) {
+	hook.endpointMu.RLock()
+	defer hook.endpointMu.RUnlock()
+	return hook.endpoints, hook.pool
+}
+
+// connectEndpoints checks the transport of the config, and connects the endpoints.
+func connectEndpoints(conf Config) ([]*endpoint, error) {
+	if err := validateTransport(conf); err != nil {
+		return nil, err
+	}
+	tlsConf, err := loadTLSConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	conf.TLS = tlsConf
+	return newEndpoints(conf)
+}
+
+// poolOf returns the loggers of all endpoints and the first one.
+func poolOf(endpoints []*endpoint) (*client.Client, []*pooledClient) {
+	var pool []*pooledClient
+	for _, e := range endpoints {
+		pool = append(pool, e.pool...)
+	}
+	if len(pool) == 0 {
+		return nil, nil
+	}
+	return pool[0].client, pool
+}
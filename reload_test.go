@@ -0,0 +1,137 @@
+package logrus_fluent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
+)
+
+func TestReload(t *testing.T) {
+	a := assert.New(t)
+
+	oldServer, err := testutil.NewServer()
+	a.NoError(err)
+	defer oldServer.Close()
+	newServer, err := testutil.NewServer()
+	a.NoError(err)
+	defer newServer.Close()
+
+	hook, err := NewWithConfig(Config{
+		Host:       oldServer.Host(),
+		Port:       oldServer.Port(),
+		DefaultTag: "old",
+	})
+	a.NoError(err)
+	defer hook.Close()
+	hook.AddIgnore("secret")
+
+	logger := logrus.New()
+	logger.Hooks.Add(hook)
+	logger.WithField("secret", "x").Info("before")
+	_, err = oldServer.WaitEvents(1, time.Second)
+	a.NoError(err)
+	_, oldPool := hook.connections()
+
+	err = hook.Reload(Config{
+		Host:        newServer.Host(),
+		Port:        newServer.Port(),
+		DefaultTag:  "new",
+		MinLevel:    logrus.WarnLevel,
+		SendTimeout: time.Second,
+	})
+	a.NoError(err)
+	a.Equal(time.Second, time.Duration(hook.sendTimeout.Load()))
+	a.Equal(levelsUpTo(logrus.WarnLevel), hook.Levels())
+	a.ErrorIs(oldPool[0].reconnect(), errConnClosed, "the swapped connection is never reconnected")
+
+	logger.WithField("secret", "x").Warn("after")
+	events, err := newServer.WaitEvents(1, time.Second)
+	a.NoError(err)
+	a.Equal("new", events[0].Tag)
+	a.Equal("after", events[0].Record["message"])
+	a.Equal("x", events[0].Record["secret"], "AddIgnore is replaced")
+	a.Len(oldServer.Events(), 1)
+	a.Equal("old", oldServer.Events()[0].Tag)
+	a.NotContains(oldServer.Events()[0].Record, "secret")
+}
+
+func TestReloadError(t *testing.T) {
+	a := assert.New(t)
+
+	server, err := testutil.NewServer()
+	a.NoError(err)
+	defer server.Close()
+
+	hook, err := NewWithConfig(Config{
+		Host:       server.Host(),
+		Port:       server.Port(),
+		DefaultTag: "old",
+	})
+	a.NoError(err)
+
+	// nothing is changed on error.
+	err = hook.Reload(Config{SocketPath: "/tmp/fluent.sock", Hosts: []string{"localhost:1"}, DefaultTag: "new"})
+	a.Error(err)
+	a.Equal("old", *hook.tag)
+	logger := logrus.New()
+	logger.Hooks.Add(hook)
+	logger.Info("message")
+	_, err = server.WaitEvents(1, time.Second)
+	a.NoError(err)
+
+	a.NoError(hook.Close())
+	a.ErrorIs(hook.Reload(Config{Host: server.Host(), Port: server.Port()}), ErrClosed)
+}
+
+func TestReloadDuringRetry(t *testing.T) {
+	a := assert.New(t)
+
+	oldServer, err := testutil.NewServer()
+	a.NoError(err)
+	defer oldServer.Close()
+	newServer, err := testutil.NewServer()
+	a.NoError(err)
+	defer newServer.Close()
+
+	// the old server never acknowledges, so the send is retried.
+	oldServer.SetAck(false)
+	conf := Config{
+		Host:                 oldServer.Host(),
+		Port:                 oldServer.Port(),
+		DefaultTag:           staticTag,
+		RequireAck:           true,
+		AckTimeout:           20 * time.Millisecond,
+		MaxRetries:           3,
+		RetryInitialInterval: 300 * time.Millisecond,
+	}
+	hook, err := NewWithConfig(conf)
+	a.NoError(err)
+	defer hook.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- hook.Fire(newEntry(nil, entryMessage))
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// Reload doesn't wait for the sleeping retry.
+	start := time.Now()
+	conf.Host, conf.Port = newServer.Host(), newServer.Port()
+	a.NoError(hook.Reload(conf))
+	a.Less(time.Since(start), 200*time.Millisecond)
+
+	// the retry is sent to the new endpoint.
+	select {
+	case err := <-done:
+		a.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Fire is not returned")
+	}
+	events, err := newServer.WaitEvents(1, time.Second)
+	a.NoError(err)
+	a.Equal(entryMessage, events[0].Record[MessageField])
+}
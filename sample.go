@@ -0,0 +1,167 @@
+package logrus_fluent
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RateLimitKey is the unit of Config.MaxPerSecond.
+type RateLimitKey int
+
+const (
+	// RateLimitGlobal limits all of the entries together.
+	RateLimitGlobal RateLimitKey = iota
+	// RateLimitPerLevel limits the entries of each level separately.
+	RateLimitPerLevel
+	// RateLimitPerTag limits the entries of each fluentd tag separately.
+	RateLimitPerTag
+)
+
+// DefaultSampleSummaryTag is the tag of the summary of the dropped entries.
+const DefaultSampleSummaryTag = "logrus_fluent.sampled"
+
+// sampler drops the entries by Config.SampleFunc, Config.SampleRate and Config.MaxPerSecond.
+type sampler struct {
+	rate         float64
+	maxPerSecond int
+	by           RateLimitKey
+	sampleFunc   func(entry *logrus.Entry) bool
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastEvict time.Time
+	now       func() time.Time
+}
+
+// bucket is the token bucket refilled at maxPerSecond, holding one second of the burst.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newSampler returns the sampler, or nil when the sampling is disabled.
+func newSampler(conf Config) *sampler {
+	if (conf.SampleRate <= 0 || conf.SampleRate >= 1) && conf.MaxPerSecond <= 0 && conf.SampleFunc == nil {
+		return nil
+	}
+	return &sampler{
+		rate:         conf.SampleRate,
+		maxPerSecond: conf.MaxPerSecond,
+		by:           conf.RateLimitBy,
+		sampleFunc:   conf.SampleFunc,
+		buckets:      make(map[string]*bucket),
+		now:          time.Now,
+	}
+}
+
+// sample reports whether the entry is sent.
+// PanicLevel and FatalLevel are always sent.
+// The entry is not limited here with RateLimitPerTag, see limitTag.
+func (s *sampler) sample(entry *logrus.Entry) bool {
+	if s == nil || entry.Level <= logrus.FatalLevel {
+		return true
+	}
+	if s.sampleFunc != nil && !s.sampleFunc(entry) {
+		return false
+	}
+	if s.rate > 0 && s.rate < 1 && rand.Float64() >= s.rate {
+		return false
+	}
+
+	switch s.by {
+	case RateLimitPerTag:
+		return true
+	case RateLimitPerLevel:
+		return s.allow(entry.Level.String())
+	default:
+		return s.allow("")
+	}
+}
+
+// limitTag reports whether the entry of the tag is sent with RateLimitPerTag.
+func (s *sampler) limitTag(level logrus.Level, tag string) bool {
+	if s == nil || level <= logrus.FatalLevel || s.by != RateLimitPerTag {
+		return true
+	}
+	return s.allow(tag)
+}
+
+// allow takes the token from the bucket of the key.
+func (s *sampler) allow(key string) bool {
+	if s.maxPerSecond <= 0 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.evict(now)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(s.maxPerSecond)}
+		s.buckets[key] = b
+	}
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * float64(s.maxPerSecond)
+		if b.tokens > float64(s.maxPerSecond) {
+			b.tokens = float64(s.maxPerSecond)
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// evict removes the buckets unused for a second at most once a second,
+// e.g. of the tags which are the messages of the entries.
+// The bucket is full again after a second, so it's the same as the new one.
+// The caller must hold mu.
+func (s *sampler) evict(now time.Time) {
+	if now.Sub(s.lastEvict) < time.Second {
+		return
+	}
+	s.lastEvict = now
+	for key, b := range s.buckets {
+		if now.Sub(b.last) >= time.Second {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// drop counts the entry dropped by the sampler.
+func (hook *FluentHook) drop() {
+	hook.stats.sampled.Add(1)
+	hook.suppressed.Add(1)
+}
+
+// sendSampleSummary sends the number of the entries dropped since the last summary.
+func (hook *FluentHook) sendSampleSummary() {
+	n := hook.suppressed.Swap(0)
+	if n == 0 {
+		return
+	}
+
+	tag := hook.conf.SampleSummaryTag
+	if tag == "" {
+		tag = DefaultSampleSummaryTag
+	}
+	data := logrus.Fields{
+		MessageField: fmt.Sprintf("%d messages suppressed", n),
+		"suppressed": n,
+		LevelField:   logrus.WarnLevel.String(),
+	}
+	hook.deliver(&event{
+		tag:    tag,
+		data:   data,
+		record: map[string]interface{}(data),
+		level:  logrus.WarnLevel,
+		time:   time.Now(),
+	})
+}
@@ -0,0 +1,141 @@
+package logrus_fluent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSampler(t *testing.T) {
+	a := assert.New(t)
+
+	a.Nil(newSampler(Config{}))
+	a.Nil(newSampler(Config{SampleRate: 1}))
+	a.NotNil(newSampler(Config{SampleRate: 0.5}))
+	a.NotNil(newSampler(Config{MaxPerSecond: 10}))
+}
+
+func TestSamplerMaxPerSecond(t *testing.T) {
+	a := assert.New(t)
+
+	now := time.Now()
+	s := newSampler(Config{MaxPerSecond: 2})
+	s.now = func() time.Time { return now }
+
+	a.True(s.sample(&logrus.Entry{Level: logrus.ErrorLevel}))
+	a.True(s.sample(&logrus.Entry{Level: logrus.ErrorLevel}))
+	a.False(s.sample(&logrus.Entry{Level: logrus.ErrorLevel}))
+	a.True(s.sample(&logrus.Entry{Level: logrus.FatalLevel}))
+	a.True(s.sample(&logrus.Entry{Level: logrus.PanicLevel}))
+
+	now = now.Add(500 * time.Millisecond)
+	a.True(s.sample(&logrus.Entry{Level: logrus.ErrorLevel}))
+	a.False(s.sample(&logrus.Entry{Level: logrus.ErrorLevel}))
+
+	// the bucket holds one second of the burst.
+	now = now.Add(time.Hour)
+	a.True(s.sample(&logrus.Entry{Level: logrus.ErrorLevel}))
+	a.True(s.sample(&logrus.Entry{Level: logrus.ErrorLevel}))
+	a.False(s.sample(&logrus.Entry{Level: logrus.ErrorLevel}))
+}
+
+func TestSamplerSampleRate(t *testing.T) {
+	a := assert.New(t)
+
+	s := newSampler(Config{SampleRate: 0.5})
+	sent := 0
+	for i := 0; i < 1000; i++ {
+		if s.sample(&logrus.Entry{Level: logrus.ErrorLevel}) {
+			sent++
+		}
+		a.True(s.sample(&logrus.Entry{Level: logrus.PanicLevel}))
+	}
+	a.InDelta(500, sent, 150)
+}
+
+func TestSamplerRateLimitBy(t *testing.T) {
+	a := assert.New(t)
+
+	now := time.Now()
+	s := newSampler(Config{MaxPerSecond: 1, RateLimitBy: RateLimitPerLevel})
+	s.now = func() time.Time { return now }
+	a.True(s.sample(&logrus.Entry{Level: logrus.ErrorLevel}))
+	a.False(s.sample(&logrus.Entry{Level: logrus.ErrorLevel}))
+	a.True(s.sample(&logrus.Entry{Level: logrus.InfoLevel}))
+	a.True(s.limitTag(logrus.InfoLevel, staticTag))
+
+	s = newSampler(Config{MaxPerSecond: 1, RateLimitBy: RateLimitPerTag})
+	s.now = func() time.Time { return now }
+	a.True(s.sample(&logrus.Entry{Level: logrus.ErrorLevel}))
+	a.True(s.sample(&logrus.Entry{Level: logrus.ErrorLevel}))
+	a.True(s.limitTag(logrus.ErrorLevel, staticTag))
+	a.False(s.limitTag(logrus.ErrorLevel, staticTag))
+	a.True(s.limitTag(logrus.ErrorLevel, fieldTag))
+	a.True(s.limitTag(logrus.FatalLevel, staticTag))
+	a.Len(s.buckets, 2)
+
+	// the idle buckets are evicted, and the limited one is kept.
+	now = now.Add(500 * time.Millisecond)
+	a.False(s.limitTag(logrus.ErrorLevel, staticTag))
+	now = now.Add(600 * time.Millisecond)
+	a.True(s.limitTag(logrus.ErrorLevel, "other"))
+	a.Len(s.buckets, 2)
+	a.Contains(s.buckets, staticTag)
+	a.NotContains(s.buckets, fieldTag)
+}
+
+func TestSamplerSampleFunc(t *testing.T) {
+	a := assert.New(t)
+
+	s := newSampler(Config{SampleFunc: func(entry *logrus.Entry) bool {
+		return entry.Message != "noisy"
+	}})
+	a.NotNil(s)
+	a.True(s.sample(&logrus.Entry{Level: logrus.InfoLevel, Message: entryMessage}))
+	a.False(s.sample(&logrus.Entry{Level: logrus.InfoLevel, Message: "noisy"}))
+	a.True(s.sample(&logrus.Entry{Level: logrus.PanicLevel, Message: "noisy"}))
+}
+
+func TestSampleSummary(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:                  testHOST,
+		Port:                  port,
+		SampleFunc:            func(*logrus.Entry) bool { return false },
+		SampleSummaryInterval: time.Hour,
+	})
+	a.NoError(err)
+
+	for i := 0; i < 3; i++ {
+		a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	}
+	a.NoError(hook.Close())
+
+	msg := receiveMessage(t, messages)
+	a.Equal(DefaultSampleSummaryTag, msg.Tag)
+	a.Equal("3 messages suppressed", msg.Record[MessageField])
+	a.EqualValues(3, msg.Record["suppressed"])
+	a.EqualValues(3, hook.Stats().Sampled)
+}
+
+func TestFireSampled(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:         testHOST,
+		Port:         port,
+		MaxPerSecond: 1,
+	})
+	a.NoError(err)
+	hook.sampler.now = func() time.Time { return time.Unix(0, 0) }
+
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	receiveMessage(t, messages)
+	a.Equal(Stats{Sent: 1, Sampled: 1}, hook.Stats())
+}
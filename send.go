@@ -0,0 +1,373 @@
+package logrus_fluent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IBM/fluent-forward-go/fluent/client"
+	"github.com/IBM/fluent-forward-go/fluent/protocol"
+	"github.com/sirupsen/logrus"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// SendError is the error of the record which failed to send, after the retries,
+// or was rejected in Fire, e.g. by Config.MaxMessageSize or Config.RecordValidator.
+// It's returned by Fire and passed to Config.OnError and the error handler of SetErrorHandler,
+// so the caller can log, retry or persist the record with errors.As.
+type SendError struct {
+	Tag      string
+	Time     time.Time
+	Record   map[string]interface{}
+	Attempts int   // number of the sends, 0 when the record was rejected without the send.
+	Err      error // the error of the last send or the rejection, e.g. ErrBreakerOpen.
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("logrus_fluent: failed to send %q after %d attempts: %v", e.Tag, e.Attempts, e.Err)
+}
+
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
+// newSendError returns the error of the event.
+func newSendError(ev *event, attempts int, err error) *SendError {
+	record, ok := ev.record.(map[string]interface{})
+	if !ok {
+		record = ev.data
+	}
+	return &SendError{
+		Tag:      ev.tag,
+		Time:     ev.time,
+		Record:   record,
+		Attempts: attempts,
+		Err:      err,
+	}
+}
+
+// deliver sends the event, and writes it into the fallback and calls the error handlers on failure.
+// Every entry of the batch is handled on failure, and the SendError of the first one is returned.
+// The chunk file of Config.BufferPath is kept on failure to replay it on the next start.
+// The event isn't sent while the circuit breaker is open, and fails with ErrBreakerOpen.
+// The panic and fatal events bypass the breaker, as they're the last records before the exit,
+// and their results aren't recorded into it.
+func (hook *FluentHook) deliver(ev *event) error {
+	var err error
+	var attempts int
+	hook.mirror(ev)
+	bypass := ev.batch == nil && ev.level <= logrus.FatalLevel
+	rejected := !bypass && !hook.breaker.allow()
+	if rejected {
+		err = ErrBreakerOpen
+	} else {
+		attempts, err = hook.post(ev)
+		if !bypass {
+			hook.breaker.done(err)
+		}
+	}
+	var result error
+	for _, e := range ev.events() {
+		if err == nil {
+			hook.buffer.remove(e)
+			hook.stats.sent.Add(1)
+			continue
+		}
+		if rejected {
+			hook.stats.breakerRejected.Add(1)
+		} else {
+			hook.stats.failed.Add(1)
+		}
+		hook.deadLetter(e, err)
+		sendErr := newSendError(e, attempts, err)
+		if result == nil {
+			result = sendErr
+		}
+		hook.fail(e, err, sendErr)
+	}
+	return result
+}
+
+// reject handles the event rejected in Fire, and returns its SendError.
+func (hook *FluentHook) reject(ev *event, err error) error {
+	sendErr := newSendError(ev, 0, err)
+	hook.fail(ev, err, sendErr)
+	return sendErr
+}
+
+// fail handles the event which is never sent, e.g. failed after the retries or rejected in Fire.
+// The cause is written into the fallback, and err is passed to Config.OnError and the error handler.
+func (hook *FluentHook) fail(e *event, cause, err error) {
+	hook.writeFallback(e.level, e.tag, e.time, e.record, cause)
+	if hook.conf.OnError != nil {
+		hook.conf.OnError(err, e.tag, e.data)
+	}
+	if fn := hook.errorHandler.Load(); fn != nil && e.entry != nil {
+		(*fn)(e.entry, err)
+	}
+}
+
+// deliverContext delivers the event, but returns the error of the context when it's done first.
+// The delivery continues in the background then, and Close waits for it.
+func (hook *FluentHook) deliverContext(ctx context.Context, ev *event) error {
+	if ctx.Done() == nil {
+		return hook.deliver(ev)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// the delivery isn't added after Close starts to wait.
+	hook.closeMu.RLock()
+	if hook.closed {
+		hook.closeMu.RUnlock()
+		return ErrClosed
+	}
+	hook.inflight.Add(1)
+	hook.closeMu.RUnlock()
+
+	done := make(chan error, 1)
+	go func() {
+		defer hook.inflight.Done()
+		done <- hook.deliver(ev)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+const defaultRetryInitialInterval = 100 * time.Millisecond
+
+// post sends the record, and fails over to the other healthy endpoints when it fails.
+// Then it's retried with the exponential backoff up to MaxRetries times.
+// It returns the number of the attempts, including the failovers and the retries.
+// The lock of the endpoints isn't held during the sends and the sleeps, not to block Reload.
+func (hook *FluentHook) post(ev *event) (int, error) {
+	endpoints, _ := hook.connections()
+
+	var e *endpoint
+	var p *pooledClient
+	if !hook.hasSender() && len(endpoints) > 0 {
+		e = hook.pickEndpoint(endpoints)
+		p = e.pick()
+	}
+	attempts := 1
+	err := hook.postOnce(e, p, ev)
+	for err != nil && e != nil && markDown(endpoints, e) {
+		next := hook.pickEndpoint(endpoints)
+		if next.down.Load() {
+			break
+		}
+		e, p = next, next.pick()
+		attempts++
+		err = hook.postOnce(e, p, ev)
+	}
+
+	maxRetries, interval, maxInterval := retryConfig(hook.conf)
+	for i := 0; i < maxRetries && err != nil; i++ {
+		hook.stats.retries.Add(1)
+		attempts++
+		time.Sleep(interval)
+		interval *= 2
+		if maxInterval > 0 && interval > maxInterval {
+			interval = maxInterval
+		}
+
+		// the endpoints swapped by Reload are disconnected, so the retry is sent to the new ones.
+		if current, _ := hook.connections(); e != nil && len(current) > 0 && !sameEndpoints(current, endpoints) {
+			endpoints = current
+			e = hook.pickEndpoint(endpoints)
+			p = e.pick()
+		}
+
+		// a partially written message may remain in the stale connection,
+		// so the retry is always sent with a new connection.
+		if err = hook.reconnect(p); err != nil {
+			// the connection closed by Close is never reconnected.
+			if errors.Is(err, errConnClosed) && hook.isClosed() {
+				break
+			}
+			continue
+		}
+		err = hook.postOnce(e, p, ev)
+	}
+	if err == nil && e != nil {
+		e.down.Store(false)
+	}
+	return attempts, err
+}
+
+// sameEndpoints reports whether the endpoints are not swapped by Reload,
+// which always creates the new ones.
+func sameEndpoints(a, b []*endpoint) bool {
+	return len(a) == len(b) && (len(a) == 0 || a[0] == b[0])
+}
+
+// retryConfig returns the number of the retries, the initial interval and the max interval.
+// The legacy MaxRetry, RetryWait and MaxRetryWait are used when the new fields aren't set.
+func retryConfig(conf Config) (int, time.Duration, time.Duration) {
+	maxRetries := conf.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = conf.MaxRetry
+	}
+	interval := conf.RetryInitialInterval
+	if interval <= 0 {
+		interval = time.Duration(conf.RetryWait) * time.Millisecond
+	}
+	if interval <= 0 {
+		interval = defaultRetryInitialInterval
+	}
+	return maxRetries, interval, time.Duration(conf.MaxRetryWait) * time.Millisecond
+}
+
+// reconnect re-establishes the connection of the persistent logger.
+// The lazy logger is reset on the failure and reconnected on the next use,
+// and the logger without the connection pool is created on every send.
+func (hook *FluentHook) reconnect(p *pooledClient) error {
+	if p == nil || p.lazy != nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.reconnect()
+}
+
+// postOnce sends the record with the sender or the persistent logger,
+// or a new logger to the endpoint is created with Config.DialPerSend.
+func (hook *FluentHook) postOnce(e *endpoint, p *pooledClient, ev *event) error {
+	switch {
+	case e == nil:
+		return hook.sendToSender(ev)
+	case p == nil:
+		logger := newClient(e.conf)
+		err := connectClient(logger)
+		if err != nil {
+			return err
+		}
+		defer logger.Disconnect()
+		return hook.send(logger, ev)
+	case p.lazy != nil:
+		logger, gen, err := p.lazy.get()
+		if err != nil {
+			return err
+		}
+		err = hook.sendPooled(p, logger, ev)
+		if err != nil {
+			p.lazy.reset(gen)
+		}
+		return err
+	default:
+		return hook.sendPooled(p, p.client, ev)
+	}
+}
+
+// sendPooled sends the record with the persistent logger.
+// The logger is shared by the worker and the callers of Fire,
+// and the message must be written into the connection at once.
+func (hook *FluentHook) sendPooled(p *pooledClient, logger *client.Client, ev *event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return hook.send(logger, ev)
+}
+
+// send sends the record of the event to fluentd with the tag.
+func (hook *FluentHook) send(logger *client.Client, ev *event) error {
+	msg, err := hook.encodeMessage(ev, logger.RequireAck)
+	if err != nil {
+		return err
+	}
+	return logger.Send(msg)
+}
+
+// encodeMessage returns the forward message of the event,
+// which is encoded and wrapped when WrapBytes is set.
+func (hook *FluentHook) encodeMessage(ev *event, requireAck bool) (protocol.ChunkEncoder, error) {
+	var msg protocol.ChunkEncoder
+	if ev.batch != nil {
+		var err error
+		if msg, err = hook.newBatchMessage(ev); err != nil {
+			return nil, err
+		}
+	} else {
+		msg = hook.newMessage(ev)
+	}
+	if hook.conf.WrapBytes == nil {
+		return msg, nil
+	}
+
+	// the chunk option is set before the encoding to wait for its ack.
+	var chunk string
+	if requireAck {
+		var err error
+		if chunk, err = msg.Chunk(); err != nil {
+			return nil, err
+		}
+	}
+	var buf bytes.Buffer
+	if err := msgp.Encode(&buf, msg); err != nil {
+		return nil, err
+	}
+	b, err := hook.conf.WrapBytes(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return &rawMessage{b: b, chunk: chunk}, nil
+}
+
+// rawMessage is the encoded message, which is written as it is.
+type rawMessage struct {
+	b     []byte
+	chunk string
+}
+
+// Chunk returns the chunk option of the encoded message.
+func (m *rawMessage) Chunk() (string, error) {
+	return m.chunk, nil
+}
+
+// EncodeMsg writes the encoded message.
+func (m *rawMessage) EncodeMsg(w *msgp.Writer) error {
+	return w.Append(m.b...)
+}
+
+// newMessage returns the forward message of the event, with the options if any.
+// The message has the entry time as EventTime when UseEventTime or SubSecondPrecision is set,
+// otherwise it has the current time in seconds.
+func (hook *FluentHook) newMessage(ev *event) protocol.ChunkEncoder {
+	eventTime := hook.conf.UseEventTime || hook.conf.SubSecondPrecision
+	record := hook.encodedRecord(ev.record)
+	if len(ev.options) > 0 {
+		m := &optionMessage{
+			tag:       ev.tag,
+			time:      time.Now(),
+			eventTime: eventTime,
+			record:    record,
+			options:   ev.options,
+		}
+		if m.eventTime {
+			m.time = ev.time
+		}
+		return m
+	}
+	if eventTime {
+		return &protocol.MessageExt{
+			Tag:       ev.tag,
+			Timestamp: protocol.EventTime{Time: ev.time},
+			Record:    record,
+		}
+	}
+	return protocol.NewMessage(ev.tag, record)
+}
+
+// encodedRecord returns the record to encode, whose keys are sorted with Config.SortFields.
+func (hook *FluentHook) encodedRecord(record interface{}) interface{} {
+	if !hook.conf.SortFields {
+		return record
+	}
+	return sortRecord(record)
+}
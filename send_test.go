@@ -0,0 +1,266 @@
+package logrus_fluent
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/fluent-forward-go/fluent/protocol"
+	"github.com/sirupsen/logrus"
+	"github.com/tinylib/msgp/msgp"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
+)
+
+func TestSendWrapBytes(t *testing.T) {
+	a := assert.New(t)
+
+	var wrapped []byte
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host: testHOST,
+		Port: port,
+		WrapBytes: func(b []byte) ([]byte, error) {
+			wrapped = b
+			return b, nil
+		},
+	})
+	a.NoError(err)
+
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	msg := receiveMessage(t, messages)
+	a.Equal(entryMessage, msg.Tag)
+	a.Equal(entryMessage, msg.Record[MessageField])
+	a.Contains(string(wrapped), entryMessage)
+}
+
+func TestSendWrapBytesError(t *testing.T) {
+	a := assert.New(t)
+
+	port, _ := newMessageServer(t)
+	errWrap := errors.New("wrap error")
+	hook, err := NewWithConfig(Config{
+		Host: testHOST,
+		Port: port,
+		WrapBytes: func(b []byte) ([]byte, error) {
+			return nil, errWrap
+		},
+	})
+	a.NoError(err)
+	a.ErrorIs(hook.Fire(newEntry(nil, entryMessage)), errWrap)
+}
+
+func TestSendRetry(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:                 testHOST,
+		Port:                 port,
+		MaxRetries:           2,
+		RetryInitialInterval: time.Millisecond,
+	})
+	a.NoError(err)
+
+	// the send fails without the session until the logger reconnects.
+	a.NoError(hook.Fluent.Disconnect())
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	msg := receiveMessage(t, messages)
+	a.Equal(entryMessage, msg.Record[MessageField])
+
+	hook.conf.MaxRetries = 0
+	a.NoError(hook.Fluent.Disconnect())
+	a.Error(hook.Fire(newEntry(nil, entryMessage)))
+}
+
+func TestSendError(t *testing.T) {
+	a := assert.New(t)
+
+	sendErr := errors.New("send error")
+	sender := testutil.NewMockSender()
+	sender.SetError(sendErr)
+	var onError error
+	hook, err := NewWithConfig(Config{
+		Sender:               sender,
+		DefaultTag:           staticTag,
+		MaxRetries:           2,
+		RetryInitialInterval: time.Millisecond,
+		BreakerThreshold:     1,
+		OnError: func(err error, tag string, data logrus.Fields) {
+			onError = err
+		},
+	})
+	a.NoError(err)
+
+	entry := newEntry(logrus.Fields{"value": fieldValue}, entryMessage)
+	err = hook.Fire(entry)
+	a.ErrorIs(err, sendErr)
+	a.Equal(err, onError)
+	var e *SendError
+	if a.ErrorAs(err, &e) {
+		a.Equal(staticTag, e.Tag)
+		a.Equal(entry.Time, e.Time)
+		a.Equal(fieldValue, e.Record["value"])
+		a.Equal(3, e.Attempts)
+		a.Contains(e.Error(), staticTag)
+	}
+
+	// the record rejected by the breaker isn't sent.
+	err = hook.Fire(newEntry(nil, entryMessage))
+	a.ErrorIs(err, ErrBreakerOpen)
+	if a.ErrorAs(err, &e) {
+		a.Equal(0, e.Attempts)
+	}
+}
+
+func TestSendTimeoutClose(t *testing.T) {
+	a := assert.New(t)
+
+	server, err := testutil.NewServer()
+	a.NoError(err)
+	defer server.Close()
+	server.SetAck(false)
+
+	var dials int32
+	hook, err := NewWithConfig(Config{
+		Host:                 server.Host(),
+		Port:                 server.Port(),
+		RequireAck:           true,
+		AckTimeout:           100 * time.Millisecond,
+		SendTimeout:          10 * time.Millisecond,
+		MaxRetries:           3,
+		RetryInitialInterval: 50 * time.Millisecond,
+		DialFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			return server.DialFunc(ctx, network, address)
+		},
+	})
+	a.NoError(err)
+
+	// the delivery continues in the background after the timeout.
+	a.ErrorIs(hook.Fire(newEntry(nil, entryMessage)), context.DeadlineExceeded)
+
+	// Close waits for it, and the closed connection isn't reconnected by its retries.
+	a.NoError(hook.Close())
+	a.EqualValues(1, hook.Stats().Failed)
+	dialed := atomic.LoadInt32(&dials)
+	time.Sleep(200 * time.Millisecond)
+	a.Equal(dialed, atomic.LoadInt32(&dials))
+	a.Equal(ErrClosed, hook.Fire(newEntry(nil, entryMessage)))
+}
+
+func TestSendRequireAck(t *testing.T) {
+	a := assert.New(t)
+
+	var acked int32
+	l, err := net.Listen("tcp", testHOST+":0")
+	a.NoError(err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := msgp.NewReader(conn)
+				for {
+					msg, err := decodeMessage(r)
+					if err != nil {
+						return
+					}
+					// the first message is not acknowledged.
+					if atomic.AddInt32(&acked, 1) == 1 {
+						continue
+					}
+					msgp.Encode(conn, &protocol.AckMessage{Ack: msg.Options["chunk"].(string)})
+				}
+			}()
+		}
+	}()
+
+	hook, err := NewWithConfig(Config{
+		Host:                 testHOST,
+		Port:                 l.Addr().(*net.TCPAddr).Port,
+		RequireAck:           true,
+		AckTimeout:           50 * time.Millisecond,
+		MaxRetries:           1,
+		RetryInitialInterval: time.Millisecond,
+	})
+	a.NoError(err)
+	a.True(hook.Fluent.RequireAck)
+
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.EqualValues(2, atomic.LoadInt32(&acked))
+
+	hook.conf.MaxRetries = 0
+	atomic.StoreInt32(&acked, 0)
+	a.Error(hook.Fire(newEntry(nil, entryMessage)))
+
+	// the wrapped message waits for the ack too.
+	hook.conf.MaxRetries = 1
+	hook.conf.WrapBytes = func(b []byte) ([]byte, error) { return b, nil }
+	atomic.StoreInt32(&acked, 0)
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.EqualValues(2, atomic.LoadInt32(&acked))
+}
+
+func TestSendUseEventTime(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:         testHOST,
+		Port:         port,
+		UseEventTime: true,
+	})
+	a.NoError(err)
+
+	now := time.Now()
+	for _, ts := range []time.Time{now, now.Add(time.Microsecond)} {
+		entry := newEntry(nil, entryMessage)
+		entry.Time = ts
+		a.NoError(hook.Fire(entry))
+
+		msg := receiveMessage(t, messages)
+		if a.IsType(&protocol.EventTime{}, msg.Time) {
+			a.True(ts.Equal(msg.Time.(*protocol.EventTime).Time))
+		}
+	}
+
+	hook.conf.UseEventTime = false
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.IsType(int64(0), receiveMessage(t, messages).Time)
+
+	hook.conf.SubSecondPrecision = true
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.IsType(&protocol.EventTime{}, receiveMessage(t, messages).Time)
+}
+
+func TestRetryConfig(t *testing.T) {
+	a := assert.New(t)
+
+	tests := []struct {
+		conf        Config
+		retries     int
+		interval    time.Duration
+		maxInterval time.Duration
+	}{
+		{Config{}, 0, defaultRetryInitialInterval, 0},
+		{Config{MaxRetries: 3, RetryInitialInterval: time.Second}, 3, time.Second, 0},
+		{Config{MaxRetry: 5, RetryWait: 500, MaxRetryWait: 60000}, 5, 500 * time.Millisecond, time.Minute},
+		{Config{MaxRetries: 3, MaxRetry: 5, RetryInitialInterval: time.Second, RetryWait: 500}, 3, time.Second, 0},
+	}
+	for _, tt := range tests {
+		retries, interval, maxInterval := retryConfig(tt.conf)
+		a.Equal(tt.retries, retries)
+		a.Equal(tt.interval, interval)
+		a.Equal(tt.maxInterval, maxInterval)
+	}
+}
@@ -0,0 +1,82 @@
+package logrus_fluent
+
+import (
+	"errors"
+
+	"github.com/IBM/fluent-forward-go/fluent/client"
+	"github.com/IBM/fluent-forward-go/fluent/protocol"
+)
+
+// FluentSender is the fluentd client used instead of the connections of the hook,
+// e.g. the mock in the testutil package or the custom transport.
+// *client.Client implements it.
+type FluentSender interface {
+	Connect() error
+	Disconnect() error
+	SendMessage(tag string, record interface{}) error
+}
+
+// chunkSender is the sender which can send the forward message as it is.
+// The message has the options, the event time and the batch when the sender implements it.
+type chunkSender interface {
+	Send(msg protocol.ChunkEncoder) error
+}
+
+var _ FluentSender = (*client.Client)(nil)
+
+var errNoSender = errors.New("logrus_fluent: sender is removed")
+
+// SetSender replaces the sender, which is used instead of the connections of the hook.
+// The sender must be connected, and nil restores the connections.
+// The hook created with Config.Sender has no connections, so nil makes the sends fail until the next SetSender.
+func (hook *FluentHook) SetSender(sender FluentSender) {
+	hook.senderMu.Lock()
+	defer hook.senderMu.Unlock()
+	hook.sender = sender
+}
+
+// hasSender reports whether the sender is set.
+func (hook *FluentHook) hasSender() bool {
+	hook.senderMu.Lock()
+	defer hook.senderMu.Unlock()
+	return hook.sender != nil
+}
+
+// sendToSender sends the event with the sender.
+// The sends are serialized, as the sender may not be safe for concurrent use.
+func (hook *FluentHook) sendToSender(ev *event) error {
+	hook.senderMu.Lock()
+	defer hook.senderMu.Unlock()
+
+	switch s := hook.sender.(type) {
+	case nil:
+		return errNoSender
+	case chunkSender:
+		var requireAck bool
+		if c, ok := s.(*client.Client); ok {
+			requireAck = c.RequireAck
+		}
+		msg, err := hook.encodeMessage(ev, requireAck)
+		if err != nil {
+			return err
+		}
+		return s.Send(msg)
+	default:
+		for _, e := range ev.events() {
+			if err := s.SendMessage(e.tag, e.record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// disconnectSender disconnects the sender if set.
+func (hook *FluentHook) disconnectSender() error {
+	hook.senderMu.Lock()
+	defer hook.senderMu.Unlock()
+	if hook.sender == nil {
+		return nil
+	}
+	return hook.sender.Disconnect()
+}
@@ -0,0 +1,52 @@
+package logrus_fluent
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
+)
+
+func TestSender(t *testing.T) {
+	a := assert.New(t)
+
+	sender := testutil.NewMockSender()
+	hook, err := NewWithConfig(Config{
+		Sender:     sender,
+		DefaultTag: staticTag,
+	})
+	a.NoError(err)
+	a.True(sender.Connected())
+	a.Nil(hook.Clients())
+
+	a.NoError(hook.Fire(newEntry(logrus.Fields{"value": fieldValue}, entryMessage)))
+	if messages := sender.Messages(); a.Len(messages, 1) {
+		a.Equal(staticTag, messages[0].Tag)
+		record := messages[0].Record.(map[string]interface{})
+		a.Equal(fieldValue, record["value"])
+		a.Equal(entryMessage, record[MessageField])
+	}
+
+	sendErr := errors.New("send error")
+	sender.SetError(sendErr)
+	a.ErrorIs(hook.Fire(newEntry(nil, entryMessage)), sendErr)
+	a.EqualValues(1, hook.Stats().Failed)
+
+	// the sender is replaced.
+	other := testutil.NewMockSender()
+	a.NoError(other.Connect())
+	hook.SetSender(other)
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.Len(other.Messages(), 1)
+
+	// the hook of Config.Sender has no connections to restore.
+	hook.SetSender(nil)
+	a.ErrorIs(hook.Fire(newEntry(nil, entryMessage)), errNoSender)
+
+	hook.SetSender(other)
+	a.NoError(hook.Close())
+	a.False(other.Connected())
+}
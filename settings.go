@@ -0,0 +1,248 @@
+package logrus_fluent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Settings are the Config fields loaded from the environment variables or the config file,
+// to tune the hook without the code changes. The zero fields are not applied to Config.
+//
+// e.g. the YAML config file:
+//
+//	host: fluentd.local
+//	port: 24224
+//	tag: app
+//	send_timeout: 5s
+type Settings struct {
+	Host       string   `json:"host" yaml:"host" env:"FLUENT_HOST"`
+	Port       int      `json:"port" yaml:"port" env:"FLUENT_PORT"`
+	Hosts      []string `json:"hosts" yaml:"hosts" env:"FLUENT_HOSTS"` // comma-separated in the environment variable.
+	SocketPath string   `json:"socket_path" yaml:"socket_path" env:"FLUENT_SOCKET_PATH"`
+
+	Tag          string `json:"tag" yaml:"tag" env:"FLUENT_TAG"`
+	TagPrefix    string `json:"tag_prefix" yaml:"tag_prefix" env:"FLUENT_TAG_PREFIX"`
+	MessageField string `json:"message_field" yaml:"message_field" env:"FLUENT_MESSAGE_FIELD"`
+	MinLevel     string `json:"min_level" yaml:"min_level" env:"FLUENT_MIN_LEVEL"` // parsed by logrus.ParseLevel.
+
+	Timeout         Duration `json:"timeout" yaml:"timeout" env:"FLUENT_TIMEOUT"`
+	WriteTimeout    Duration `json:"write_timeout" yaml:"write_timeout" env:"FLUENT_WRITE_TIMEOUT"`
+	SendTimeout     Duration `json:"send_timeout" yaml:"send_timeout" env:"FLUENT_SEND_TIMEOUT"`
+	AckTimeout      Duration `json:"ack_timeout" yaml:"ack_timeout" env:"FLUENT_ACK_TIMEOUT"`
+	ConnectTimeout  Duration `json:"connect_timeout" yaml:"connect_timeout" env:"FLUENT_CONNECT_TIMEOUT"`
+	ReadTimeout     Duration `json:"read_timeout" yaml:"read_timeout" env:"FLUENT_READ_TIMEOUT"`
+	KeepAlive       Duration `json:"keepalive" yaml:"keepalive" env:"FLUENT_KEEPALIVE"`
+	RequireAck      bool     `json:"require_ack" yaml:"require_ack" env:"FLUENT_REQUIRE_ACK"`
+	MaxRetries      int      `json:"max_retries" yaml:"max_retries" env:"FLUENT_MAX_RETRIES"`
+	AsyncBufferSize int      `json:"async_buffer_size" yaml:"async_buffer_size" env:"FLUENT_ASYNC_BUFFER_SIZE"`
+
+	TLSEnabled            bool   `json:"tls" yaml:"tls" env:"FLUENT_TLS"`
+	TLSCAFile             string `json:"tls_ca_file" yaml:"tls_ca_file" env:"FLUENT_TLS_CA_FILE"`
+	TLSCertFile           string `json:"tls_cert_file" yaml:"tls_cert_file" env:"FLUENT_TLS_CERT_FILE"`
+	TLSKeyFile            string `json:"tls_key_file" yaml:"tls_key_file" env:"FLUENT_TLS_KEY_FILE"`
+	TLSServerName         string `json:"tls_server_name" yaml:"tls_server_name" env:"FLUENT_TLS_SERVER_NAME"`
+	TLSInsecureSkipVerify bool   `json:"tls_insecure_skip_verify" yaml:"tls_insecure_skip_verify" env:"FLUENT_TLS_INSECURE_SKIP_VERIFY"`
+
+	SharedKey    string `json:"shared_key" yaml:"shared_key" env:"FLUENT_SHARED_KEY"`
+	SelfHostname string `json:"self_hostname" yaml:"self_hostname" env:"FLUENT_SELF_HOSTNAME"`
+	Username     string `json:"username" yaml:"username" env:"FLUENT_USERNAME"`
+	Password     string `json:"password" yaml:"password" env:"FLUENT_PASSWORD"`
+}
+
+// Duration is time.Duration written as the string of time.ParseDuration, e.g. "1.5s".
+type Duration time.Duration
+
+// UnmarshalText parses the duration.
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalText formats the duration.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Apply returns the config with the non-zero settings.
+func (s Settings) Apply(conf Config) (Config, error) {
+	if s.MinLevel != "" {
+		level, err := logrus.ParseLevel(s.MinLevel)
+		if err != nil {
+			return conf, err
+		}
+		conf.MinLevel = level
+	}
+	setString(&conf.Host, s.Host)
+	setString(&conf.SocketPath, s.SocketPath)
+	setString(&conf.DefaultTag, s.Tag)
+	setString(&conf.TagPrefix, s.TagPrefix)
+	setString(&conf.DefaultMessageField, s.MessageField)
+	setString(&conf.TLSCAFile, s.TLSCAFile)
+	setString(&conf.TLSCertFile, s.TLSCertFile)
+	setString(&conf.TLSKeyFile, s.TLSKeyFile)
+	setString(&conf.TLSServerName, s.TLSServerName)
+	setString(&conf.SharedKey, s.SharedKey)
+	setString(&conf.SelfHostname, s.SelfHostname)
+	setString(&conf.Username, s.Username)
+	setString(&conf.Password, s.Password)
+	if s.Port != 0 {
+		conf.Port = s.Port
+	}
+	if len(s.Hosts) > 0 {
+		conf.Hosts = s.Hosts
+	}
+	if s.Timeout != 0 {
+		conf.Timeout = time.Duration(s.Timeout)
+	}
+	if s.WriteTimeout != 0 {
+		conf.WriteTimeout = time.Duration(s.WriteTimeout)
+	}
+	if s.SendTimeout != 0 {
+		conf.SendTimeout = time.Duration(s.SendTimeout)
+	}
+	if s.AckTimeout != 0 {
+		conf.AckTimeout = time.Duration(s.AckTimeout)
+	}
+	if s.ConnectTimeout != 0 {
+		conf.ConnectTimeout = time.Duration(s.ConnectTimeout)
+	}
+	if s.ReadTimeout != 0 {
+		conf.ReadTimeout = time.Duration(s.ReadTimeout)
+	}
+	if s.KeepAlive != 0 {
+		conf.KeepAlive = time.Duration(s.KeepAlive)
+	}
+	if s.MaxRetries != 0 {
+		conf.MaxRetries = s.MaxRetries
+	}
+	if s.AsyncBufferSize != 0 {
+		conf.AsyncBufferSize = s.AsyncBufferSize
+	}
+	conf.RequireAck = conf.RequireAck || s.RequireAck
+	conf.TLSEnabled = conf.TLSEnabled || s.TLSEnabled
+	conf.TLSInsecureSkipVerify = conf.TLSInsecureSkipVerify || s.TLSInsecureSkipVerify
+	return conf, nil
+}
+
+func setString(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
+
+// SettingsFromEnv loads the settings from the environment variables in the env tags of Settings.
+func SettingsFromEnv() (Settings, error) {
+	var s Settings
+	rv := reflect.ValueOf(&s).Elem()
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("env")
+		v, ok := os.LookupEnv(name)
+		if !ok || v == "" {
+			continue
+		}
+		if err := setEnvValue(rv.Field(i), v); err != nil {
+			return s, fmt.Errorf("logrus_fluent: invalid %s: %w", name, err)
+		}
+	}
+	return s, nil
+}
+
+// setEnvValue parses the value of the environment variable into the field.
+func setEnvValue(field reflect.Value, v string) error {
+	switch p := field.Addr().Interface().(type) {
+	case *string:
+		*p = v
+	case *int:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*p = n
+	case *bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*p = b
+	case *Duration:
+		return p.UnmarshalText([]byte(v))
+	case *[]string:
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				*p = append(*p, s)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// LoadSettings loads the settings from the JSON file of ".json" extension, or the YAML file.
+// The unknown keys are rejected to find the typos.
+func LoadSettings(path string) (Settings, error) {
+	var s Settings
+	f, err := os.Open(path)
+	if err != nil {
+		return s, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		d := json.NewDecoder(f)
+		d.DisallowUnknownFields()
+		err = d.Decode(&s)
+	} else {
+		d := yaml.NewDecoder(f)
+		d.KnownFields(true)
+		if err = d.Decode(&s); errors.Is(err, io.EOF) {
+			err = nil // empty file
+		}
+	}
+	if err != nil {
+		return s, fmt.Errorf("logrus_fluent: invalid config file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// NewFromEnv returns initialized logrus hook by the environment variables, see Settings.
+func NewFromEnv() (*FluentHook, error) {
+	s, err := SettingsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return newFromSettings(s)
+}
+
+// NewFromFile returns initialized logrus hook by the JSON or YAML config file, see Settings.
+func NewFromFile(path string) (*FluentHook, error) {
+	s, err := LoadSettings(path)
+	if err != nil {
+		return nil, err
+	}
+	return newFromSettings(s)
+}
+
+func newFromSettings(s Settings) (*FluentHook, error) {
+	conf, err := s.Apply(Config{DefaultMessageField: MessageField})
+	if err != nil {
+		return nil, err
+	}
+	return NewWithConfig(conf)
+}
@@ -0,0 +1,132 @@
+package logrus_fluent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettingsApply(t *testing.T) {
+	a := assert.New(t)
+
+	conf, err := Settings{
+		Host:        "fluentd",
+		Port:        24225,
+		Tag:         staticTag,
+		MinLevel:    "debug",
+		SendTimeout: Duration(time.Second),
+		ReadTimeout: Duration(time.Minute),
+		RequireAck:  true,
+	}.Apply(Config{Host: "localhost", DefaultMessageField: MessageField})
+	a.NoError(err)
+	a.Equal("fluentd", conf.Host)
+	a.Equal(24225, conf.Port)
+	a.Equal(staticTag, conf.DefaultTag)
+	a.Equal(MessageField, conf.DefaultMessageField)
+	a.Equal(logrus.DebugLevel, conf.MinLevel)
+	a.Equal(time.Second, conf.SendTimeout)
+	a.Equal(time.Minute, conf.ReadTimeout)
+	a.True(conf.RequireAck)
+
+	_, err = Settings{MinLevel: "unknown"}.Apply(Config{})
+	a.Error(err)
+}
+
+func TestSettingsFromEnv(t *testing.T) {
+	a := assert.New(t)
+
+	t.Setenv("FLUENT_HOST", "fluentd")
+	t.Setenv("FLUENT_PORT", "24225")
+	t.Setenv("FLUENT_HOSTS", "a:1, b:2")
+	t.Setenv("FLUENT_TAG", staticTag)
+	t.Setenv("FLUENT_TIMEOUT", "1.5s")
+	t.Setenv("FLUENT_TLS", "true")
+	t.Setenv("FLUENT_USERNAME", "user")
+	s, err := SettingsFromEnv()
+	a.NoError(err)
+	a.Equal(Settings{
+		Host:       "fluentd",
+		Port:       24225,
+		Hosts:      []string{"a:1", "b:2"},
+		Tag:        staticTag,
+		Timeout:    Duration(1500 * time.Millisecond),
+		TLSEnabled: true,
+		Username:   "user",
+	}, s)
+
+	t.Setenv("FLUENT_PORT", "port")
+	_, err = SettingsFromEnv()
+	a.ErrorContains(err, "FLUENT_PORT")
+}
+
+func TestLoadSettings(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+	expected := Settings{
+		Host:         "fluentd",
+		Port:         24225,
+		Tag:          "tag",
+		WriteTimeout: Duration(time.Second),
+	}
+
+	path := filepath.Join(dir, "fluent.yaml")
+	a.NoError(os.WriteFile(path, []byte("host: fluentd\nport: 24225\ntag: tag\nwrite_timeout: 1s\n"), 0o600))
+	s, err := LoadSettings(path)
+	a.NoError(err)
+	a.Equal(expected, s)
+
+	path = filepath.Join(dir, "fluent.json")
+	a.NoError(os.WriteFile(path, []byte(`{"host": "fluentd", "port": 24225, "tag": "tag", "write_timeout": "1s"}`), 0o600))
+	s, err = LoadSettings(path)
+	a.NoError(err)
+	a.Equal(expected, s)
+
+	// the unknown key is rejected.
+	path = filepath.Join(dir, "typo.yaml")
+	a.NoError(os.WriteFile(path, []byte("hots: fluentd\n"), 0o600))
+	_, err = LoadSettings(path)
+	a.Error(err)
+
+	path = filepath.Join(dir, "empty.yml")
+	a.NoError(os.WriteFile(path, nil, 0o600))
+	s, err = LoadSettings(path)
+	a.NoError(err)
+	a.Equal(Settings{}, s)
+}
+
+func TestNewFromFile(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	path := filepath.Join(t.TempDir(), "fluent.yaml")
+	a.NoError(os.WriteFile(path, []byte(fmt.Sprintf("host: %s\nport: %d\ntag: %s\n", testHOST, port, staticTag)), 0o600))
+	hook, err := NewFromFile(path)
+	a.NoError(err)
+	defer hook.Close()
+
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	msg := receiveMessage(t, messages)
+	a.Equal(staticTag, msg.Tag)
+	a.Equal(entryMessage, msg.Record[MessageField])
+}
+
+func TestNewFromEnv(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	t.Setenv("FLUENT_HOST", testHOST)
+	t.Setenv("FLUENT_PORT", strconv.Itoa(port))
+	t.Setenv("FLUENT_TAG", staticTag)
+	hook, err := NewFromEnv()
+	a.NoError(err)
+	defer hook.Close()
+
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.Equal(staticTag, receiveMessage(t, messages).Tag)
+}
@@ -0,0 +1,190 @@
+package logrus_fluent
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RecordIDField is field name of the id shared by the record split by Config.SplitLargeRecords
+	// and its follow-up records.
+	RecordIDField = "record_id"
+	// SplitFieldsField is field name of the field names moved into the follow-up records.
+	SplitFieldsField = "split_fields"
+	// SplitFieldField is field name of the field name which the follow-up record has.
+	SplitFieldField = "split_field"
+	// SplitPartField and SplitPartsField are field names of the index and the number of the parts,
+	// set when the string is split into several follow-up records.
+	SplitPartField  = "split_part"
+	SplitPartsField = "split_parts"
+)
+
+const (
+	// messageOverhead is the estimated size of the forward message without the entries:
+	// the array header, the time and the options, added to the tag.
+	messageOverhead = 64
+	// entryOverhead is the size of the entry without the record: the array header and EventTime.
+	entryOverhead = 11
+	// partOverhead is the estimated size of the split fields in the follow-up record.
+	partOverhead = 64
+)
+
+// splitBatch partitions the batch so that every forward message fits in the max size.
+// The entry larger than the max size is sent alone, and fails on the send if fluentd rejects it.
+func splitBatch(tag string, batch []*event, max int) [][]*event {
+	if max <= 0 {
+		return [][]*event{batch}
+	}
+
+	var batches [][]*event
+	var current []*event
+	size := len(tag) + messageOverhead
+	for _, ev := range batch {
+		n := msgpSize(ev.record) + entryOverhead
+		if len(current) > 0 && size+n > max {
+			batches = append(batches, current)
+			current, size = nil, len(tag)+messageOverhead
+		}
+		current = append(current, ev)
+		size += n
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+// deliverBatch delivers the batch split by Config.MaxChunkSize.
+func (hook *FluentHook) deliverBatch(tag string, batch []*event) {
+	for _, b := range splitBatch(tag, batch, hook.conf.MaxChunkSize) {
+		hook.deliver(&event{tag: tag, batch: b})
+	}
+}
+
+// splitEvent splits the record of the event with Config.SplitLargeRecords, and returns the events of the follow-up records.
+// The follow-up records are checked by Config.MaxMessageSize like the record, which is kept as it is on error.
+func (hook *FluentHook) splitEvent(ev *event) ([]*event, error) {
+	record, parts := hook.splitRecord(ev.tag, ev.record)
+	events := make([]*event, 0, len(parts))
+	for _, part := range parts {
+		if err := limitMessageSize(part, hook.conf.MaxMessageSize, hook.conf.MessageSizePolicy); err != nil {
+			return nil, err
+		}
+		hook.setContentHash(ev.tag, part)
+		events = append(events, &event{
+			tag:     ev.tag,
+			data:    logrus.Fields(part),
+			record:  part,
+			options: ev.options,
+			level:   ev.level,
+			time:    ev.time,
+			entry:   ev.entry,
+		})
+	}
+	ev.record = record
+	return events, nil
+}
+
+// splitRecord moves the largest fields of the record over Config.MaxChunkSize into the follow-up records
+// with Config.SplitLargeRecords, and returns the copy of the record without them and the follow-up records.
+// The records share RecordIDField, and the string larger than the max size is split into the parts.
+func (hook *FluentHook) splitRecord(tag string, record interface{}) (interface{}, []map[string]interface{}) {
+	m, ok := record.(map[string]interface{})
+	limit := hook.conf.MaxChunkSize - len(tag) - messageOverhead
+	if !hook.conf.SplitLargeRecords || !ok || limit <= 0 || msgpSize(m) <= limit {
+		return record, nil
+	}
+
+	id, err := newRecordID()
+	if err != nil {
+		return record, nil
+	}
+	main := make(map[string]interface{}, len(m)+2)
+	for k, v := range m {
+		main[k] = v
+	}
+	main[RecordIDField] = id
+	var moved []string
+	var parts []map[string]interface{}
+	for msgpSize(main) > limit {
+		key := largestSplitField(main)
+		if key == "" {
+			break
+		}
+		parts = append(parts, splitField(id, key, main[key], limit)...)
+		delete(main, key)
+		moved = append(moved, key)
+		main[SplitFieldsField] = moved
+	}
+	return main, parts
+}
+
+// largestSplitField returns the key of the largest field which can be moved.
+// The keys are sorted to decide the field deterministically.
+func largestSplitField(m map[string]interface{}) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if k != RecordIDField && k != SplitFieldsField {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var key string
+	var max int
+	for _, k := range keys {
+		if size := msgpSize(m[k]); size > max {
+			key, max = k, size
+		}
+	}
+	return key
+}
+
+// splitField returns the follow-up records of the field.
+// Only the string is split into the parts, and the other values are sent as they are.
+func splitField(id, key string, value interface{}, limit int) []map[string]interface{} {
+	room := limit - len(id) - 2*len(key) - partOverhead
+	s, ok := value.(string)
+	if !ok || room <= 0 || len(s) <= room {
+		return []map[string]interface{}{{RecordIDField: id, SplitFieldField: key, key: value}}
+	}
+
+	var pieces []string
+	for len(s) > room {
+		n := room
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		if n == 0 {
+			n = room
+		}
+		pieces = append(pieces, s[:n])
+		s = s[n:]
+	}
+	pieces = append(pieces, s)
+
+	parts := make([]map[string]interface{}, len(pieces))
+	for i, piece := range pieces {
+		parts[i] = map[string]interface{}{
+			RecordIDField:   id,
+			SplitFieldField: key,
+			SplitPartField:  i,
+			SplitPartsField: len(pieces),
+			key:             piece,
+		}
+	}
+	return parts
+}
+
+// newRecordID returns the random id of the split record.
+func newRecordID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,152 @@
+package logrus_fluent
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
+)
+
+func TestSplitBatch(t *testing.T) {
+	a := assert.New(t)
+
+	var batch []*event
+	for i := 0; i < 5; i++ {
+		batch = append(batch, &event{record: map[string]interface{}{"value": strings.Repeat("x", 100)}})
+	}
+	a.Equal([][]*event{batch}, splitBatch(staticTag, batch, 0))
+	a.Equal([][]*event{batch}, splitBatch(staticTag, batch, 1<<20))
+
+	batches := splitBatch(staticTag, batch, 400)
+	if a.Len(batches, 3) {
+		a.Len(batches[0], 2)
+		a.Len(batches[1], 2)
+		a.Len(batches[2], 1)
+	}
+
+	// the large entry is sent alone.
+	batches = splitBatch(staticTag, batch, 10)
+	a.Len(batches, 5)
+}
+
+func TestSplitLargeRecords(t *testing.T) {
+	a := assert.New(t)
+
+	sender := testutil.NewMockSender()
+	hook, err := NewWithConfig(Config{
+		Sender:            sender,
+		DefaultTag:        staticTag,
+		MaxChunkSize:      1024,
+		SplitLargeRecords: true,
+	})
+	a.NoError(err)
+
+	stack := strings.Repeat("stack ", 500)
+	a.NoError(hook.Fire(newEntry(logrus.Fields{"stack": stack, "body": strings.Repeat("b", 500), "user": 1}, entryMessage)))
+	messages := sender.Messages()
+	if !a.Greater(len(messages), 2) {
+		return
+	}
+
+	main := messages[0].Record.(map[string]interface{})
+	id := main[RecordIDField]
+	a.NotEmpty(id)
+	a.Equal(1, main["user"])
+	a.Equal([]string{"stack"}, main[SplitFieldsField])
+	a.NotContains(main, "stack")
+	a.Equal(strings.Repeat("b", 500), main["body"])
+
+	var joined strings.Builder
+	for i, m := range messages[1:] {
+		a.Equal(staticTag, m.Tag)
+		part := m.Record.(map[string]interface{})
+		a.Equal(id, part[RecordIDField])
+		a.Equal("stack", part[SplitFieldField])
+		a.Equal(i, part[SplitPartField])
+		a.Equal(len(messages)-1, part[SplitPartsField])
+		a.LessOrEqual(msgpSize(part), 1024)
+		joined.WriteString(part["stack"].(string))
+	}
+	a.Equal(stack, joined.String())
+
+	// the small record isn't split.
+	sender.Reset()
+	a.NoError(hook.Fire(newEntry(logrus.Fields{"user": 1}, entryMessage)))
+	if a.Len(sender.Messages(), 1) {
+		a.NotContains(sender.Messages()[0].Record, RecordIDField)
+	}
+}
+
+func TestSplitLargeRecordsLimits(t *testing.T) {
+	a := assert.New(t)
+
+	var fallback bytes.Buffer
+	sender := testutil.NewMockSender()
+	hook, err := NewWithConfig(Config{
+		Sender:            sender,
+		DefaultTag:        staticTag,
+		MaxChunkSize:      1024,
+		SplitLargeRecords: true,
+		MaxMessageSize:    2048,
+		MessageSizePolicy: MessageSizeDropRecord,
+		Fallback:          &fallback,
+	})
+	a.NoError(err)
+
+	// the record over MaxMessageSize is rejected before it's split.
+	err = hook.Fire(newEntry(logrus.Fields{"stack": strings.Repeat("stack ", 500)}, entryMessage))
+	a.ErrorIs(err, ErrMessageTooLarge)
+	a.Empty(sender.Messages())
+	a.Contains(fallback.String(), "stack stack")
+	a.NotContains(fallback.String(), RecordIDField)
+
+	// the follow-up record over MaxMessageSize rejects the record, which is kept as it is.
+	list := make([]interface{}, 100)
+	for i := range list {
+		list[i] = strings.Repeat("x", 10)
+	}
+	record := map[string]interface{}{"list": list}
+	hook.conf.MaxMessageSize = msgpSize(record) + 5
+	ev := &event{tag: staticTag, record: record}
+	parts, err := hook.splitEvent(ev)
+	a.ErrorIs(err, ErrMessageTooLarge)
+	a.Nil(parts)
+	a.Equal(map[string]interface{}{"list": list}, ev.record)
+}
+
+func TestSplitLargeRecordsFailure(t *testing.T) {
+	a := assert.New(t)
+
+	var mirror bytes.Buffer
+	sender := testutil.NewMockSender()
+	sender.SetError(errors.New("send error"))
+	hook, err := NewWithConfig(Config{
+		Sender:            sender,
+		DefaultTag:        staticTag,
+		MaxChunkSize:      1024,
+		SplitLargeRecords: true,
+		MirrorOutputs:     []io.Writer{&mirror},
+	})
+	a.NoError(err)
+	var handled []*logrus.Entry
+	hook.SetErrorHandler(func(entry *logrus.Entry, err error) {
+		handled = append(handled, entry)
+	})
+
+	a.Error(hook.Fire(newEntry(logrus.Fields{"stack": strings.Repeat("stack ", 500)}, entryMessage)))
+	lines := strings.Count(mirror.String(), "\n")
+	a.Greater(lines, 2, "the follow-up records are mirrored")
+	if a.Len(handled, lines) {
+		for _, entry := range handled {
+			if a.NotNil(entry) {
+				a.Equal(entryMessage, entry.Message)
+			}
+		}
+	}
+}
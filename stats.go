@@ -0,0 +1,63 @@
+package logrus_fluent
+
+import (
+	"sync/atomic"
+)
+
+// Stats is the statistics of the hook.
+type Stats struct {
+	Sent             uint64 // number of the records sent to fluentd.
+	Failed           uint64 // number of the records failed to send after the retries.
+	ValidationFailed uint64 // number of the records rejected by Config.RecordValidator.
+	Dropped          uint64 // number of the entries dropped as the async buffer is full.
+	Sampled          uint64 // number of the entries dropped by SampleRate and MaxPerSecond.
+	Retries          uint64 // number of the retries of the sends.
+	Intercepted      uint64 // number of the entries skipped by the interceptors.
+	Oversized        uint64 // number of the records dropped over Config.MaxMessageSize.
+	BreakerRejected  uint64 // number of the records rejected by the open circuit breaker.
+	Deduplicated     uint64 // number of the duplicate entries collapsed by Config.DedupWindow.
+
+	QueueLength   int // number of the entries in the async buffer.
+	EndpointsDown int // number of the endpoints whose last send failed.
+
+	BreakerState BreakerState // state of the circuit breaker, always BreakerClosed when it's disabled.
+}
+
+// stats holds the counters updated by the hook.
+type stats struct {
+	sent             atomic.Uint64
+	failed           atomic.Uint64
+	validationFailed atomic.Uint64
+	dropped          atomic.Uint64
+	sampled          atomic.Uint64
+	retries          atomic.Uint64
+	intercepted      atomic.Uint64
+	oversized        atomic.Uint64
+	breakerRejected  atomic.Uint64
+	deduplicated     atomic.Uint64
+}
+
+// Stats returns the snapshot of the statistics.
+func (hook *FluentHook) Stats() Stats {
+	s := Stats{
+		Sent:             hook.stats.sent.Load(),
+		Failed:           hook.stats.failed.Load(),
+		ValidationFailed: hook.stats.validationFailed.Load(),
+		Dropped:          hook.stats.dropped.Load(),
+		Sampled:          hook.stats.sampled.Load(),
+		Retries:          hook.stats.retries.Load(),
+		Intercepted:      hook.stats.intercepted.Load(),
+		Oversized:        hook.stats.oversized.Load(),
+		BreakerRejected:  hook.stats.breakerRejected.Load(),
+		Deduplicated:     hook.stats.deduplicated.Load(),
+		QueueLength:      len(hook.queue),
+		BreakerState:     hook.breaker.currentState(),
+	}
+	endpoints, _ := hook.connections()
+	for _, e := range endpoints {
+		if e.down.Load() {
+			s.EndpointsDown++
+		}
+	}
+	return s
+}
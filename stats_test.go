@@ -0,0 +1,35 @@
+package logrus_fluent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host: testHOST,
+		Port: port,
+	})
+	a.NoError(err)
+
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	receiveMessage(t, messages)
+	a.NoError(hook.Fluent.Disconnect())
+	a.Error(hook.Fire(newEntry(nil, entryMessage)))
+
+	a.Equal(Stats{Sent: 1, Failed: 1, EndpointsDown: 1}, hook.Stats())
+
+	// the endpoint recovers on the successful retry.
+	hook.conf.MaxRetries = 1
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	receiveMessage(t, messages)
+	a.Equal(Stats{Sent: 2, Failed: 1, Retries: 1}, hook.Stats())
+
+	hook.queue = make(chan *event, 2)
+	hook.queue <- &event{}
+	a.Equal(1, hook.Stats().QueueLength)
+}
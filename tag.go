@@ -0,0 +1,114 @@
+package logrus_fluent
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TagRoute maps the log fields to fluentd tag.
+type TagRoute struct {
+	// Field and Value match when the field has the same value.
+	Field string
+	Value interface{}
+	// Match is used instead of Field and Value if set.
+	Match func(data logrus.Fields) bool
+	// Tag is used as fluentd tag when the route matches.
+	Tag string
+}
+
+// match checks the route matches the log fields or not.
+func (r TagRoute) match(data logrus.Fields) bool {
+	if r.Match != nil {
+		return r.Match(data)
+	}
+	v, ok := data[r.Field]
+	return ok && reflect.DeepEqual(v, r.Value)
+}
+
+// routeTag returns the tag of the first matched route.
+// Config.TagRouteDefault is used when no route matches.
+func (hook *FluentHook) routeTag(data logrus.Fields) (string, bool) {
+	for _, r := range hook.conf.TagRoutes {
+		if r.match(data) {
+			return r.Tag, true
+		}
+	}
+	if hook.conf.TagRouteDefault != "" {
+		return hook.conf.TagRouteDefault, true
+	}
+	return "", false
+}
+
+const tagTemplateFieldPrefix = "field:"
+
+// tagTemplate is the parsed Config.TagTemplate.
+type tagTemplate []tagTemplatePart
+
+// tagTemplatePart is the literal text or the placeholder.
+type tagTemplatePart struct {
+	text        string
+	placeholder string // "level", "message" or "field"
+	field       string
+}
+
+// parseTagTemplate parses the template with {level}, {message} and {field:key}.
+// Unknown placeholders are kept as they are.
+func parseTagTemplate(s string) tagTemplate {
+	var t tagTemplate
+	for s != "" {
+		start := strings.IndexByte(s, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		var p tagTemplatePart
+		switch name := s[start+1 : end]; {
+		case name == "level", name == "message":
+			p.placeholder = name
+		case strings.HasPrefix(name, tagTemplateFieldPrefix):
+			p.placeholder = "field"
+			p.field = strings.TrimPrefix(name, tagTemplateFieldPrefix)
+		default:
+			t = append(t, tagTemplatePart{text: s[:end+1]})
+			s = s[end+1:]
+			continue
+		}
+		if start > 0 {
+			t = append(t, tagTemplatePart{text: s[:start]})
+		}
+		t = append(t, p)
+		s = s[end+1:]
+	}
+	if s != "" {
+		t = append(t, tagTemplatePart{text: s})
+	}
+	return t
+}
+
+// render returns the tag of the entry. Missing fields are rendered as empty strings.
+func (t tagTemplate) render(entry *logrus.Entry, data logrus.Fields) string {
+	var b strings.Builder
+	for _, p := range t {
+		switch p.placeholder {
+		case "level":
+			b.WriteString(entry.Level.String())
+		case "message":
+			b.WriteString(entry.Message)
+		case "field":
+			if v, ok := data[p.field]; ok && v != nil {
+				fmt.Fprint(&b, v)
+			}
+		default:
+			b.WriteString(p.text)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,159 @@
+package logrus_fluent
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTagAndDelWithRoutes(t *testing.T) {
+	a := assert.New(t)
+
+	routes := []TagRoute{
+		{Field: "kind", Value: "audit", Tag: "audit.logs"},
+		{Match: func(data logrus.Fields) bool { return data["user"] != nil }, Tag: "user.logs"},
+		{Field: "kind", Value: "security", Tag: "security.logs"},
+	}
+
+	tests := []struct {
+		data         logrus.Fields
+		defaultRoute string
+		expected     string
+	}{
+		{logrus.Fields{"kind": "audit", "user": "alice"}, "", "audit.logs"},
+		{logrus.Fields{"kind": "security", "user": "alice"}, "", "user.logs"},
+		{logrus.Fields{"kind": "security"}, "", "security.logs"},
+		{logrus.Fields{"kind": "other"}, "", entryMessage},
+		{logrus.Fields{"kind": "other"}, "app.logs", "app.logs"},
+		{logrus.Fields{"kind": "audit", "tag": fieldTag}, "app.logs", fieldTag},
+	}
+
+	for _, tt := range tests {
+		hook := &FluentHook{
+			conf: Config{
+				TagRoutes:       routes,
+				TagRouteDefault: tt.defaultRoute,
+			},
+		}
+		entry := &logrus.Entry{Message: entryMessage}
+		a.Equal(tt.expected, hook.getTagAndDel(entry, tt.data))
+	}
+}
+
+func TestGetTagAndDelWithTemplate(t *testing.T) {
+	a := assert.New(t)
+
+	tests := []struct {
+		template string
+		data     logrus.Fields
+		expected string
+	}{
+		{"myapp.{field:env}.{level}", logrus.Fields{"env": "prod"}, "myapp.prod.error"},
+		{"myapp.{field:env}.{level}", logrus.Fields{}, "myapp..error"},
+		{"{message}", logrus.Fields{}, entryMessage},
+		{"{field:count}-{unknown}-{field:tag}", logrus.Fields{"count": 3, "tag": fieldTag}, "3-{unknown}-" + fieldTag},
+		{"{level", logrus.Fields{}, "{level"},
+	}
+
+	for _, tt := range tests {
+		hook := &FluentHook{tagTemplate: parseTagTemplate(tt.template)}
+		entry := &logrus.Entry{Message: entryMessage, Level: logrus.ErrorLevel}
+		a.Equal(tt.expected, hook.getTagAndDel(entry, tt.data), tt.template)
+		a.NotContains(tt.data, TagField)
+	}
+
+	// the static tag takes precedence over the template.
+	hook := &FluentHook{tagTemplate: parseTagTemplate("{level}")}
+	hook.SetTag(staticTag)
+	a.Equal(staticTag, hook.getTagAndDel(&logrus.Entry{}, logrus.Fields{}))
+}
+
+func TestGetTagAndDelWithFunc(t *testing.T) {
+	a := assert.New(t)
+
+	hook := &FluentHook{
+		conf: Config{
+			TagFunc: func(entry *logrus.Entry) string {
+				if env, ok := entry.Data["env"].(string); ok {
+					return "myapp." + env + "." + entry.Level.String()
+				}
+				return ""
+			},
+		},
+		tagTemplate: parseTagTemplate("{level}"),
+	}
+
+	data := logrus.Fields{"env": "prod", TagField: fieldTag}
+	entry := &logrus.Entry{Data: data, Level: logrus.ErrorLevel}
+	a.Equal("myapp.prod.error", hook.getTagAndDel(entry, data))
+	a.NotContains(data, TagField)
+
+	// the empty result falls back to the template.
+	entry = &logrus.Entry{Data: logrus.Fields{}, Level: logrus.WarnLevel}
+	a.Equal("warning", hook.getTagAndDel(entry, logrus.Fields{}))
+
+	// the static tag takes precedence over the func.
+	hook.SetTag(staticTag)
+	entry = &logrus.Entry{Data: logrus.Fields{"env": "prod"}}
+	a.Equal(staticTag, hook.getTagAndDel(entry, logrus.Fields{}))
+}
+
+func TestGetTagAndDelWithTagByLevel(t *testing.T) {
+	a := assert.New(t)
+
+	hook := &FluentHook{
+		conf: Config{
+			TagByLevel: map[logrus.Level]string{
+				logrus.ErrorLevel: "audit.security",
+				logrus.WarnLevel:  "audit.security",
+			},
+		},
+	}
+	hook.SetTag(staticTag)
+
+	// the level tag takes precedence over the static tag and the tag field.
+	data := logrus.Fields{TagField: fieldTag}
+	a.Equal("audit.security", hook.getTagAndDel(&logrus.Entry{Level: logrus.WarnLevel}, data))
+	a.NotContains(data, TagField)
+	a.Equal(staticTag, hook.getTagAndDel(&logrus.Entry{Level: logrus.InfoLevel}, logrus.Fields{}))
+
+	hook.conf.TagByLevelDefault = "app.logs"
+	a.Equal("app.logs", hook.getTagAndDel(&logrus.Entry{Level: logrus.InfoLevel}, logrus.Fields{}))
+	a.Equal("audit.security", hook.getTagAndDel(&logrus.Entry{Level: logrus.ErrorLevel}, logrus.Fields{}))
+}
+
+func TestTagPrefix(t *testing.T) {
+	a := assert.New(t)
+
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:      testHOST,
+		Port:      port,
+		TagPrefix: "svc.api",
+	})
+	a.NoError(err)
+
+	// the tag falls back to entry.Message.
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.Equal("svc.api."+entryMessage, receiveMessage(t, messages).Tag)
+
+	hook.SetTagPrefix("svc.api.")
+	a.NoError(hook.Fire(newEntry(logrus.Fields{"tag": fieldTag}, entryMessage)))
+	a.Equal("svc.api."+fieldTag, receiveMessage(t, messages).Tag)
+
+	hook.SetTagPrefix("")
+	a.NoError(hook.Fire(newEntry(nil, entryMessage)))
+	a.Equal(entryMessage, receiveMessage(t, messages).Tag)
+}
+
+func TestTagLevelSuffix(t *testing.T) {
+	a := assert.New(t)
+
+	hook := &FluentHook{}
+	a.Equal("myapp", hook.suffixTag("myapp", logrus.ErrorLevel))
+
+	hook.conf.TagLevelSuffix = true
+	a.Equal("myapp.error", hook.suffixTag("myapp", logrus.ErrorLevel))
+	a.Equal("myapp.debug", hook.suffixTag("myapp", logrus.DebugLevel))
+}
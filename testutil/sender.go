@@ -0,0 +1,89 @@
+// Package testutil provides the helpers to test the code logging with logrus_fluent,
+// e.g. MockSender and the fake fluentd Server, without the real fluentd.
+package testutil
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNotConnected is returned when MockSender sends before Connect.
+var ErrNotConnected = errors.New("testutil: sender is not connected")
+
+// Message is the message received by MockSender.
+type Message struct {
+	Tag    string
+	Record interface{}
+}
+
+// MockSender is the in-memory logrus_fluent.FluentSender, which records the messages.
+// It's safe for concurrent use.
+type MockSender struct {
+	mu        sync.Mutex
+	connected bool
+	messages  []Message
+	err       error
+}
+
+// NewMockSender returns the disconnected MockSender.
+func NewMockSender() *MockSender {
+	return &MockSender{}
+}
+
+// Connect connects the sender.
+func (s *MockSender) Connect() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connected = true
+	return nil
+}
+
+// Disconnect disconnects the sender.
+func (s *MockSender) Disconnect() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connected = false
+	return nil
+}
+
+// Connected reports whether the sender is connected.
+func (s *MockSender) Connected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connected
+}
+
+// SendMessage records the message, or returns the error set by SetError.
+func (s *MockSender) SendMessage(tag string, record interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.err != nil:
+		return s.err
+	case !s.connected:
+		return ErrNotConnected
+	}
+	s.messages = append(s.messages, Message{Tag: tag, Record: record})
+	return nil
+}
+
+// SetError makes SendMessage fail with the error, and nil restores it.
+func (s *MockSender) SetError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// Messages returns the recorded messages.
+func (s *MockSender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Reset removes the recorded messages.
+func (s *MockSender) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+}
@@ -0,0 +1,376 @@
+package testutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/IBM/fluent-forward-go/fluent/protocol"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// Event is the event received by Server.
+type Event struct {
+	Tag     string
+	Time    time.Time
+	Record  map[string]interface{}
+	Options map[string]interface{} // option map of the forward message, nil when it's not sent.
+}
+
+// Server is the fake fluentd, which decodes the forward protocol messages
+// (Message, Forward, PackedForward and CompressedPackedForward) and records the events.
+// It answers the ack when the message has the chunk option.
+// It's safe for concurrent use.
+type Server struct {
+	l net.Listener
+
+	mu        sync.Mutex
+	events    []Event
+	conns     map[net.Conn]struct{}
+	noAck     bool
+	readDelay time.Duration
+	received  chan struct{} // closed and replaced on every event.
+	closed    bool
+
+	wg sync.WaitGroup
+}
+
+// NewServer starts the server listening on the random port of localhost.
+// Call Close after the test.
+func NewServer() (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		l:        l,
+		conns:    make(map[net.Conn]struct{}),
+		received: make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// Host returns the host of the server, for Config.Host.
+func (s *Server) Host() string {
+	return s.l.Addr().(*net.TCPAddr).IP.String()
+}
+
+// Port returns the port of the server, for Config.Port.
+func (s *Server) Port() int {
+	return s.l.Addr().(*net.TCPAddr).Port
+}
+
+// Addr returns the address of the server in "host:port".
+func (s *Server) Addr() string {
+	return s.l.Addr().String()
+}
+
+// DialFunc connects to the server in memory by net.Pipe, for Config.DialFunc.
+// The network and the address are ignored.
+func (s *Server) DialFunc(ctx context.Context, network, address string) (net.Conn, error) {
+	client, server := net.Pipe()
+	if !s.serve(server) {
+		client.Close()
+		return nil, net.ErrClosed
+	}
+	return client, nil
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		s.serve(conn)
+	}
+}
+
+// serve handles the connection in background. It returns false after Close.
+func (s *Server) serve(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		conn.Close()
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	go s.handle(conn)
+	return true
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := msgp.NewReader(conn)
+	for {
+		events, chunk, err := decodeForward(r)
+		if err != nil {
+			return
+		}
+		if d := s.delay(); d > 0 {
+			time.Sleep(d)
+		}
+		s.record(events)
+		if chunk != "" && s.ackEnabled() {
+			if err := msgp.Encode(conn, &protocol.AckMessage{Ack: chunk}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) record(events []Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	close(s.received)
+	s.received = make(chan struct{})
+}
+
+func (s *Server) delay() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readDelay
+}
+
+func (s *Server) ackEnabled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.noAck
+}
+
+// Events returns the received events.
+func (s *Server) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Event(nil), s.events...)
+}
+
+// WaitEvents waits until n events are received, and returns them.
+// It returns the events received so far with the error on the timeout.
+func (s *Server) WaitEvents(n int, timeout time.Duration) ([]Event, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		s.mu.Lock()
+		events := append([]Event(nil), s.events...)
+		received := s.received
+		s.mu.Unlock()
+		if len(events) >= n {
+			return events, nil
+		}
+
+		select {
+		case <-received:
+		case <-deadline.C:
+			return events, fmt.Errorf("testutil: %d of %d events are received in %s", len(events), n, timeout)
+		}
+	}
+}
+
+// Reset removes the received events.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = nil
+}
+
+// SetAck enables or disables the ack to the chunk option. It's enabled by default.
+// The disabled ack makes the client with RequireAck time out.
+func (s *Server) SetAck(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.noAck = !enabled
+}
+
+// SetReadDelay makes the server sleep after reading every message before it's recorded and acked,
+// to simulate the slow fluentd.
+func (s *Server) SetReadDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readDelay = d
+}
+
+// DisconnectAll closes all of the current connections, to simulate the restart of fluentd.
+// The server still accepts the new connections.
+func (s *Server) DisconnectAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// Close stops the server and closes all of the connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	err := s.l.Close()
+	s.DisconnectAll()
+	s.wg.Wait()
+	return err
+}
+
+// decodeForward decodes the message of any forward mode, and returns the events and the chunk option.
+func decodeForward(r *msgp.Reader) ([]Event, string, error) {
+	size, err := r.ReadArrayHeader()
+	if err != nil {
+		return nil, "", err
+	}
+	if size < 2 {
+		return nil, "", fmt.Errorf("testutil: invalid message size %d", size)
+	}
+	tag, err := r.ReadString()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var events []Event
+	var stream []byte
+	rest := size - 1 // elements after the tag
+	switch typ, err := r.NextType(); {
+	case err != nil:
+		return nil, "", err
+	case typ == msgp.ArrayType: // Forward
+		n, err := r.ReadArrayHeader()
+		if err != nil {
+			return nil, "", err
+		}
+		for i := uint32(0); i < n; i++ {
+			ev, err := decodeEntry(r, tag)
+			if err != nil {
+				return nil, "", err
+			}
+			events = append(events, ev)
+		}
+		rest--
+	case typ == msgp.BinType || typ == msgp.StrType: // PackedForward and CompressedPackedForward
+		if typ == msgp.BinType {
+			stream, err = r.ReadBytes(nil)
+		} else {
+			var str string
+			str, err = r.ReadString()
+			stream = []byte(str)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		rest--
+	default: // Message
+		if size < 3 {
+			return nil, "", fmt.Errorf("testutil: invalid message size %d", size)
+		}
+		ev, err := decodeTimeAndRecord(r, tag)
+		if err != nil {
+			return nil, "", err
+		}
+		events = append(events, ev)
+		rest -= 2
+	}
+
+	var options map[string]interface{}
+	if rest > 0 {
+		if typ, _ := r.NextType(); typ == msgp.NilType {
+			err = r.ReadNil()
+		} else {
+			options = make(map[string]interface{})
+			err = r.ReadMapStrIntf(options)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		for i := uint32(1); i < rest; i++ {
+			if err := r.Skip(); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	if stream != nil {
+		if events, err = decodeStream(stream, tag, options); err != nil {
+			return nil, "", err
+		}
+	}
+	for i := range events {
+		events[i].Options = options
+	}
+	chunk, _ := options["chunk"].(string)
+	return events, chunk, nil
+}
+
+// decodeStream decodes the entries of PackedForward, which are gzipped with the compressed option.
+func decodeStream(stream []byte, tag string, options map[string]interface{}) ([]Event, error) {
+	var src io.Reader = bytes.NewReader(stream)
+	if options["compressed"] == "gzip" {
+		zr, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		src = zr
+	}
+
+	r := msgp.NewReader(src)
+	var events []Event
+	for {
+		ev, err := decodeEntry(r, tag)
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+}
+
+// decodeEntry decodes the entry of [time, record].
+func decodeEntry(r *msgp.Reader, tag string) (Event, error) {
+	n, err := r.ReadArrayHeader()
+	if err != nil {
+		return Event{}, err
+	}
+	if n != 2 {
+		return Event{}, fmt.Errorf("testutil: invalid entry size %d", n)
+	}
+	return decodeTimeAndRecord(r, tag)
+}
+
+func decodeTimeAndRecord(r *msgp.Reader, tag string) (Event, error) {
+	ev := Event{Tag: tag}
+	v, err := r.ReadIntf()
+	if err != nil {
+		return ev, err
+	}
+	switch t := v.(type) {
+	case *protocol.EventTime:
+		ev.Time = t.Time
+	case int64:
+		ev.Time = time.Unix(t, 0)
+	case uint64:
+		ev.Time = time.Unix(int64(t), 0)
+	default:
+		return ev, fmt.Errorf("testutil: invalid time %T", v)
+	}
+	ev.Record = make(map[string]interface{})
+	return ev, r.ReadMapStrIntf(ev.Record)
+}
@@ -0,0 +1,133 @@
+package testutil_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	logrus_fluent "github.com/jmaitrehenry/logrus_fluent"
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
+)
+
+func newEntry(fields logrus.Fields, message string) *logrus.Entry {
+	entry := logrus.NewEntry(logrus.New()).WithFields(fields)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = message
+	entry.Time = time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	return entry
+}
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		name string
+		conf logrus_fluent.Config
+	}{
+		{"message", logrus_fluent.Config{}},
+		{"event time and ack", logrus_fluent.Config{UseEventTime: true, RequireAck: true}},
+		{"forward", logrus_fluent.Config{AsyncBufferSize: 10, BatchMode: logrus_fluent.BatchForward}},
+		{"packed forward", logrus_fluent.Config{AsyncBufferSize: 10, BatchMode: logrus_fluent.BatchPackedForward}},
+		{"compressed packed forward", logrus_fluent.Config{AsyncBufferSize: 10, BatchMode: logrus_fluent.BatchCompressedPackedForward}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			server, err := testutil.NewServer()
+			a.NoError(err)
+			defer server.Close()
+
+			conf := tt.conf
+			conf.Host = server.Host()
+			conf.Port = server.Port()
+			conf.DefaultTag = "app"
+			hook, err := logrus_fluent.NewWithConfig(conf)
+			a.NoError(err)
+			for i := 0; i < 3; i++ {
+				a.NoError(hook.Fire(newEntry(logrus.Fields{"value": i}, "message")))
+			}
+			a.NoError(hook.Close())
+
+			events, err := server.WaitEvents(3, time.Second)
+			a.NoError(err)
+			if a.Len(events, 3) {
+				for i, ev := range events {
+					a.Equal("app", ev.Tag)
+					a.EqualValues(i, ev.Record["value"])
+					a.Equal("message", ev.Record["message"])
+				}
+				if conf.UseEventTime || conf.BatchMode != logrus_fluent.BatchNone {
+					a.True(events[0].Time.Equal(newEntry(nil, "").Time))
+				}
+				if conf.RequireAck {
+					a.Contains(events[0].Options, "chunk")
+				}
+			}
+		})
+	}
+}
+
+func TestServerDialFunc(t *testing.T) {
+	a := assert.New(t)
+
+	server, err := testutil.NewServer()
+	a.NoError(err)
+	defer server.Close()
+
+	hook, err := logrus_fluent.NewWithConfig(logrus_fluent.Config{
+		Host:       "fluentd.invalid",
+		Port:       24224,
+		DefaultTag: "app",
+		RequireAck: true,
+		DialFunc:   server.DialFunc,
+	})
+	a.NoError(err)
+	defer hook.Close()
+
+	a.NoError(hook.Fire(newEntry(nil, "message")))
+	events := server.Events()
+	if a.Len(events, 1) {
+		a.Equal("message", events[0].Record["message"])
+	}
+}
+
+func TestServerFailures(t *testing.T) {
+	a := assert.New(t)
+
+	server, err := testutil.NewServer()
+	a.NoError(err)
+	defer server.Close()
+
+	hook, err := logrus_fluent.NewWithConfig(logrus_fluent.Config{
+		Host:       server.Host(),
+		Port:       server.Port(),
+		DefaultTag: "app",
+		RequireAck: true,
+		AckTimeout: 100 * time.Millisecond,
+		MaxRetries: 1,
+	})
+	a.NoError(err)
+	defer hook.Close()
+
+	// the missing ack fails the send, though the event is received.
+	server.SetAck(false)
+	a.Error(hook.Fire(newEntry(nil, "no ack")))
+	server.SetAck(true)
+
+	// the slow server delays the send.
+	server.SetReadDelay(50 * time.Millisecond)
+	start := time.Now()
+	a.NoError(hook.Fire(newEntry(nil, "slow")))
+	a.GreaterOrEqual(time.Since(start), 50*time.Millisecond)
+	server.SetReadDelay(0)
+
+	// the hook reconnects after the disconnect, though the first write into the closed connection may be lost.
+	server.DisconnectAll()
+	server.Reset()
+	a.Eventually(func() bool {
+		hook.Fire(newEntry(nil, "reconnected"))
+		return len(server.Events()) > 0
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,39 @@
+package logrus_fluent
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// TraceIDField is the default field name of the trace ID.
+	TraceIDField = "trace_id"
+	// SpanIDField is the default field name of the span ID.
+	SpanIDField = "span_id"
+)
+
+// TraceContextFunc returns the trace ID and the span ID of the context, e.g. OpenTelemetry span context.
+// The empty IDs are not added.
+type TraceContextFunc func(ctx context.Context) (traceID, spanID string)
+
+// traceContextExtractor returns the context extractor which adds the trace and span IDs.
+func traceContextExtractor(fn TraceContextFunc, traceIDField, spanIDField string) func(ctx context.Context) logrus.Fields {
+	if traceIDField == "" {
+		traceIDField = TraceIDField
+	}
+	if spanIDField == "" {
+		spanIDField = SpanIDField
+	}
+	return func(ctx context.Context) logrus.Fields {
+		traceID, spanID := fn(ctx)
+		fields := make(logrus.Fields, 2)
+		if traceID != "" {
+			fields[traceIDField] = traceID
+		}
+		if spanID != "" {
+			fields[spanIDField] = spanID
+		}
+		return fields
+	}
+}
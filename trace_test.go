@@ -0,0 +1,51 @@
+package logrus_fluent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmaitrehenry/logrus_fluent/testutil"
+)
+
+func TestTraceContextFunc(t *testing.T) {
+	a := assert.New(t)
+
+	traceContext := func(ctx context.Context) (string, string) {
+		traceID, _ := ctx.Value(contextKey("trace")).(string)
+		spanID, _ := ctx.Value(contextKey("span")).(string)
+		return traceID, spanID
+	}
+
+	sender := testutil.NewMockSender()
+	hook, err := NewWithConfig(Config{
+		Sender:           sender,
+		DefaultTag:       staticTag,
+		TraceContextFunc: traceContext,
+		SpanIDField:      "span.id",
+	})
+	a.NoError(err)
+
+	ctx := context.WithValue(context.Background(), contextKey("trace"), "4bf92f3577b34da6a3ce929d0e0e4736")
+	ctx = context.WithValue(ctx, contextKey("span"), "00f067aa0ba902b7")
+	entry := newEntry(nil, entryMessage)
+	entry.Context = ctx
+	a.NoError(hook.Fire(entry))
+
+	// no trace in the context
+	entry = newEntry(logrus.Fields{TraceIDField: "from entry"}, entryMessage)
+	entry.Context = context.Background()
+	a.NoError(hook.Fire(entry))
+
+	if messages := sender.Messages(); a.Len(messages, 2) {
+		record := messages[0].Record.(map[string]interface{})
+		a.Equal("4bf92f3577b34da6a3ce929d0e0e4736", record[TraceIDField])
+		a.Equal("00f067aa0ba902b7", record["span.id"])
+
+		record = messages[1].Record.(map[string]interface{})
+		a.Equal("from entry", record[TraceIDField])
+		a.NotContains(record, "span.id")
+	}
+}
@@ -0,0 +1,43 @@
+package logrus_fluent
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RequireFields returns the record validator to check the required fields and their kinds.
+// reflect.Invalid accepts the field of any type.
+//
+//	conf.RecordValidator = logrus_fluent.RequireFields(map[string]reflect.Kind{
+//		"message": reflect.String,
+//		"user_id": reflect.Int,
+//		"request": reflect.Invalid,
+//	})
+func RequireFields(spec map[string]reflect.Kind) func(tag string, data logrus.Fields) error {
+	keys := make([]string, 0, len(spec))
+	for k := range spec {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return func(tag string, data logrus.Fields) error {
+		for _, k := range keys {
+			v, ok := data[k]
+			if !ok {
+				return fmt.Errorf("field %q is required", k)
+			}
+
+			kind := spec[k]
+			if kind == reflect.Invalid {
+				continue
+			}
+			if actual := reflect.ValueOf(v).Kind(); actual != kind {
+				return fmt.Errorf("field %q must be %s, but %s", k, kind, actual)
+			}
+		}
+		return nil
+	}
+}
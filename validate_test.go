@@ -0,0 +1,72 @@
+package logrus_fluent
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireFields(t *testing.T) {
+	a := assert.New(t)
+
+	validate := RequireFields(map[string]reflect.Kind{
+		"message": reflect.String,
+		"user_id": reflect.Int,
+		"request": reflect.Invalid,
+	})
+
+	a.NoError(validate(fieldTag, logrus.Fields{"message": "msg", "user_id": 1, "request": nil}))
+	a.EqualError(validate(fieldTag, logrus.Fields{"message": "msg", "user_id": 1}),
+		`field "request" is required`)
+	a.EqualError(validate(fieldTag, logrus.Fields{"message": "msg", "user_id": "1", "request": 1}),
+		`field "user_id" must be int, but string`)
+}
+
+func TestRecordValidator(t *testing.T) {
+	a := assert.New(t)
+
+	var buf bytes.Buffer
+	var failed error
+	var failedTag string
+	port, messages := newMessageServer(t)
+	hook, err := NewWithConfig(Config{
+		Host:     testHOST,
+		Port:     port,
+		Fallback: &buf,
+		OnError: func(err error, tag string, data logrus.Fields) {
+			failed, failedTag = err, tag
+		},
+		RecordValidator: RequireFields(map[string]reflect.Kind{
+			"user_id": reflect.Int,
+		}),
+	})
+	a.NoError(err)
+
+	var handled *logrus.Entry
+	hook.SetErrorHandler(func(entry *logrus.Entry, err error) {
+		handled = entry
+	})
+
+	a.NoError(hook.Fire(newEntry(logrus.Fields{"user_id": 1}, entryMessage)))
+	msg := receiveMessage(t, messages)
+	a.EqualValues(1, msg.Record["user_id"])
+	a.NoError(failed)
+
+	err = hook.Fire(newEntry(nil, entryMessage))
+	var sendErr *SendError
+	if a.ErrorAs(err, &sendErr) {
+		a.EqualError(sendErr.Err, `field "user_id" is required`)
+		a.Equal(entryMessage, sendErr.Tag)
+		a.Zero(sendErr.Attempts)
+	}
+	a.EqualValues(1, hook.Stats().ValidationFailed)
+	a.Contains(buf.String(), entryMessage)
+	a.Equal(err, failed)
+	a.Equal(entryMessage, failedTag)
+	if a.NotNil(handled) {
+		a.Equal(entryMessage, handled.Message)
+	}
+}
@@ -0,0 +1,130 @@
+package logrus_fluent
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/IBM/fluent-forward-go/fluent/client"
+	"github.com/IBM/fluent-forward-go/fluent/client/ws"
+	"github.com/IBM/fluent-forward-go/fluent/client/ws/ext"
+	"github.com/IBM/fluent-forward-go/fluent/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// Config.Transport
+const (
+	// TransportTCP sends the forward messages over TCP or the unix domain socket. (default)
+	TransportTCP = "tcp"
+	// TransportWebSocket sends the forward messages over the websocket to Config.URL.
+	TransportWebSocket = "ws"
+)
+
+// wsSender is the FluentSender of TransportWebSocket.
+type wsSender struct {
+	client *client.WSClient
+}
+
+var (
+	_ FluentSender = (*wsSender)(nil)
+	_ chunkSender  = (*wsSender)(nil)
+)
+
+// newWSSender returns the sender to Config.URL, which is connected by NewWithConfig.
+func newWSSender(conf Config) (*wsSender, error) {
+	switch {
+	case conf.URL == "":
+		return nil, errors.New("logrus_fluent: URL must be specified with the websocket transport")
+	case conf.Host != "" || conf.Port != 0 || len(conf.Hosts) > 0 || socketPath(conf) != "":
+		return nil, errors.New("logrus_fluent: both URL and Host/Port are specified")
+	case conf.RequireAck:
+		return nil, errors.New("logrus_fluent: RequireAck isn't supported with the websocket transport")
+	case conf.ReadTimeout != 0:
+		return nil, errors.New("logrus_fluent: ReadTimeout isn't supported with the websocket transport")
+	}
+	tlsConf, err := loadTLSConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	conf.TLS = tlsConf
+
+	factory := &wsFactory{
+		url:    conf.URL,
+		header: conf.Headers,
+		dialer: websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: connectTimeout(conf),
+			TLSClientConfig:  tlsConfig(conf),
+		},
+		writeTimeout: conf.WriteTimeout,
+	}
+	if conf.KeepAlive != 0 {
+		factory.dialer.NetDialContext = (&net.Dialer{KeepAlive: conf.KeepAlive}).DialContext
+	}
+	return &wsSender{client: client.NewWS(client.WSConnectionOptions{Factory: factory})}, nil
+}
+
+func (s *wsSender) Connect() error {
+	return s.client.Connect()
+}
+
+func (s *wsSender) Disconnect() error {
+	return s.client.Disconnect()
+}
+
+// SendMessage sends the record as a Message with the current time.
+func (s *wsSender) SendMessage(tag string, record interface{}) error {
+	return s.Send(protocol.NewMessage(tag, record))
+}
+
+// Send sends the forward message as a binary message.
+// The connection is re-established after the failure, so the retry is sent with the new one.
+func (s *wsSender) Send(msg protocol.ChunkEncoder) error {
+	err := s.client.Send(msg)
+	if err != nil {
+		s.client.Reconnect()
+	}
+	return err
+}
+
+// wsFactory dials the websocket with the headers, the timeout of the handshake and the write deadline,
+// which client.DefaultWSConnectionFactory doesn't support.
+type wsFactory struct {
+	url          string
+	header       http.Header
+	dialer       websocket.Dialer
+	writeTimeout time.Duration
+}
+
+func (f *wsFactory) New() (ext.Conn, error) {
+	conn, resp, err := f.dialer.Dial(f.url, f.header)
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.writeTimeout > 0 {
+		return &wsDeadlineConn{Conn: conn, writeTimeout: f.writeTimeout}, nil
+	}
+	return conn, nil
+}
+
+func (f *wsFactory) NewSession(conn ws.Connection) *client.WSSession {
+	return &client.WSSession{URL: f.url, Connection: conn}
+}
+
+// wsDeadlineConn sets Config.WriteTimeout as the deadline of every message,
+// so the stalled peer can't block Fire forever.
+type wsDeadlineConn struct {
+	*websocket.Conn
+	writeTimeout time.Duration
+}
+
+func (c *wsDeadlineConn) WriteMessage(messageType int, data []byte) error {
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
+		return err
+	}
+	return c.Conn.WriteMessage(messageType, data)
+}
@@ -0,0 +1,100 @@
+package logrus_fluent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tinylib/msgp/msgp"
+)
+
+func TestWebSocketTransport(t *testing.T) {
+	a := assert.New(t)
+
+	type received struct {
+		auth string
+		msg  []interface{}
+	}
+	messages := make(chan received, 10)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			typ, b, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if typ != websocket.BinaryMessage {
+				continue
+			}
+			v, _, err := msgp.ReadIntfBytes(b)
+			if err != nil {
+				return
+			}
+			msg, _ := v.([]interface{})
+			messages <- received{auth: r.Header.Get("Authorization"), msg: msg}
+		}
+	}))
+	defer server.Close()
+
+	hook, err := NewWithConfig(Config{
+		Transport:    TransportWebSocket,
+		URL:          "ws" + strings.TrimPrefix(server.URL, "http"),
+		Headers:      http.Header{"Authorization": {"Bearer token"}},
+		DefaultTag:   staticTag,
+		WriteTimeout: time.Second,
+		KeepAlive:    time.Second,
+	})
+	a.NoError(err)
+	defer hook.Close()
+
+	a.NoError(hook.Fire(newEntry(logrus.Fields{"value": fieldValue}, entryMessage)))
+	select {
+	case r := <-messages:
+		a.Equal("Bearer token", r.auth)
+		if a.GreaterOrEqual(len(r.msg), 3) {
+			a.Equal(staticTag, r.msg[0])
+			record := r.msg[2].(map[string]interface{})
+			a.Equal(fieldValue, record["value"])
+			a.Equal(entryMessage, record[MessageField])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message is not received")
+	}
+
+	// WriteTimeout is set as the deadline of every message.
+	factory := &wsFactory{url: "ws" + strings.TrimPrefix(server.URL, "http"), writeTimeout: time.Second}
+	conn, err := factory.New()
+	if a.NoError(err) {
+		a.IsType(&wsDeadlineConn{}, conn)
+		conn.Close()
+	}
+}
+
+func TestWebSocketTransportConfig(t *testing.T) {
+	a := assert.New(t)
+
+	_, err := NewWithConfig(Config{Transport: TransportWebSocket})
+	a.Error(err, "URL is required")
+	_, err = NewWithConfig(Config{Transport: TransportWebSocket, URL: "ws://localhost:1", Host: "localhost"})
+	a.Error(err)
+	_, err = NewWithConfig(Config{Transport: "udp", Host: "localhost", Port: 1})
+	a.Error(err)
+	_, err = NewWithConfig(Config{Transport: TransportWebSocket, URL: "ws://localhost:1", RequireAck: true})
+	a.ErrorContains(err, "RequireAck")
+	_, err = NewWithConfig(Config{Transport: TransportWebSocket, URL: "ws://localhost:1", ReadTimeout: time.Second})
+	a.ErrorContains(err, "ReadTimeout")
+
+	// the handshake fails.
+	_, err = NewWithConfig(Config{Transport: TransportWebSocket, URL: "ws://127.0.0.1:1"})
+	a.Error(err)
+}